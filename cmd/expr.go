@@ -0,0 +1,306 @@
+// Copyright © 2020 Ulrich Anhalt <ulrich.anhalt@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// arithmetic expression of derived values, e.g. "used / total * 100"
+type expr interface {
+	eval(lookup func(field string) (float64, error)) (float64, error)
+}
+
+// number literal
+type numberExpr float64
+
+// field or path of the function module result
+type fieldExpr string
+
+// negation
+type negExpr struct {
+	x expr
+}
+
+// +, -, * or / of two expressions
+type binaryExpr struct {
+	op   byte
+	x, y expr
+}
+
+func (e numberExpr) eval(lookup func(string) (float64, error)) (float64, error) {
+	return float64(e), nil
+}
+
+func (e fieldExpr) eval(lookup func(string) (float64, error)) (float64, error) {
+	return lookup(string(e))
+}
+
+func (e negExpr) eval(lookup func(string) (float64, error)) (float64, error) {
+	x, err := e.x.eval(lookup)
+	return -x, err
+}
+
+func (e binaryExpr) eval(lookup func(string) (float64, error)) (float64, error) {
+	x, err := e.x.eval(lookup)
+	if err != nil {
+		return 0, err
+	}
+	y, err := e.y.eval(lookup)
+	if err != nil {
+		return 0, err
+	}
+
+	switch e.op {
+	case '+':
+		return x + y, nil
+	case '-':
+		return x - y, nil
+	case '*':
+		return x * y, nil
+	default:
+		if 0 == y {
+			return 0, errors.New("expr - division by zero")
+		}
+		return x / y, nil
+	}
+}
+
+// recursive descent parser of arithmetic expressions
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = factor { ("*" | "/") factor }
+//	factor = number | field | "(" expr ")" | "-" factor
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+// parse arithmetic expression
+func parseExpr(s string) (expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, errors.New("parseExpr - unexpected " + p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+// split expression into numbers, fields, operators and parentheses
+func tokenize(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case ' ' == c || '\t' == c:
+			i++
+		case strings.IndexByte("+-*/()", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		case isFieldChar(c):
+			j := i
+			for j < len(s) && isFieldChar(s[j]) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			return nil, errors.New("tokenize - unexpected character " + string(c))
+		}
+	}
+	return tokens, nil
+}
+
+// characters of numbers and field paths
+func isFieldChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("_.[]", c) >= 0
+}
+
+// next token without consuming it, "" at the end
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) expr() (expr, error) {
+	x, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for "+" == p.peek() || "-" == p.peek() {
+		op := p.tokens[p.pos][0]
+		p.pos++
+		y, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryExpr{op, x, y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) term() (expr, error) {
+	x, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for "*" == p.peek() || "/" == p.peek() {
+		op := p.tokens[p.pos][0]
+		p.pos++
+		y, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryExpr{op, x, y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) factor() (expr, error) {
+	token := p.peek()
+	p.pos++
+
+	switch {
+	case "" == token:
+		return nil, errors.New("parseExpr - unexpected end")
+	case "-" == token:
+		x, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return negExpr{x}, nil
+	case "(" == token:
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if ")" != p.peek() {
+			return nil, errors.New("parseExpr - missing )")
+		}
+		p.pos++
+		return x, nil
+	case token[0] >= '0' && token[0] <= '9':
+		f64Val, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "parseExpr")
+		}
+		return numberExpr(f64Val), nil
+	case isFieldChar(token[0]):
+		if !validPath(token) || strings.Contains(token, "[]") {
+			return nil, errors.New("parseExpr - wrong field " + token)
+		}
+		return fieldExpr(low(token)), nil
+	default:
+		return nil, errors.New("parseExpr - unexpected " + token)
+	}
+}
+
+// derived value definitions of a metric
+type derivedValues struct {
+	names []string
+	exprs map[string]expr
+}
+
+// parse the expressions of the derived values
+func parseDerived(derived map[string]string) (derivedValues, bool) {
+	dv := derivedValues{exprs: make(map[string]expr)}
+	for name, definition := range derived {
+		e, err := parseExpr(definition)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"name":       name,
+				"definition": definition,
+				"error":      err,
+			}).Error("Derived: wrong expression")
+			return derivedValues{}, false
+		}
+		dv.names = append(dv.names, low(name))
+		dv.exprs[low(name)] = e
+	}
+	sort.Strings(dv.names)
+	return dv, true
+}
+
+// fields used in the expressions of the derived values
+func (dv derivedValues) fields() []string {
+	var fields []string
+	var walk func(e expr)
+	walk = func(e expr) {
+		switch x := e.(type) {
+		case fieldExpr:
+			fields = append(fields, string(x))
+		case negExpr:
+			walk(x.x)
+		case binaryExpr:
+			walk(x.x)
+			walk(x.y)
+		}
+	}
+	for _, name := range dv.names {
+		walk(dv.exprs[name])
+	}
+	return fields
+}
+
+// metric records of the derived values of the data,
+// the field label of the records is the name of the derived value with the prefix
+func (dv derivedValues) metricData(data map[string]interface{}, vc valueConv, system SystemInfo, srvName, prefix string) []metricRecord {
+
+	lookup := func(field string) (float64, error) {
+		values := resolvePath(data, field)
+		if 1 != len(values) {
+			return 0, errors.New("derived - field not found: " + field)
+		}
+		return vc.number(field, values[0].value)
+	}
+
+	var md []metricRecord
+	for _, name := range dv.names {
+		f64Val, err := dv.exprs[name].eval(lookup)
+		if err == nil && (math.IsNaN(f64Val) || math.IsInf(f64Val, 0)) {
+			err = errors.New("derived - result is not a number")
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"derived": name,
+				"error":   err,
+			}).Error("metricData: derived value can't be computed")
+			continue
+		}
+
+		md = append(md, metricRecord{
+			labels:      []string{"system", "usage", "server", "field"},
+			labelValues: []string{system.Name, system.Usage, srvName, prefix + name},
+			value:       f64Val,
+		})
+	}
+	return md
+}
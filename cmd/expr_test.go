@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseExpr(t *testing.T) {
+	assert := assert.New(t)
+
+	fields := map[string]float64{"used": 3, "total": 4, "info.memory.free": 1, "et_result[1].value": 2, "zero": 0}
+	lookup := func(field string) (float64, error) {
+		if val, ok := fields[field]; ok {
+			return val, nil
+		}
+		return 0, errors.New("unknown field " + field)
+	}
+
+	tests := []struct {
+		expression string
+		value      float64
+	}{
+		{"used / total * 100", 75},
+		{"USED/TOTAL*100", 75},
+		{"100 * (total - used) / total", 25},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"8 - 2 - 1", 5},
+		{"8 / 2 / 2", 2},
+		{"-used + -(-total)", 1},
+		{"info.memory.free * 1e3", 1000},
+		{"et_result[1].value + 0.5", 2.5},
+	}
+	for _, test := range tests {
+		e, err := parseExpr(test.expression)
+		if !assert.NoError(err, test.expression) {
+			continue
+		}
+		val, err := e.eval(lookup)
+		assert.NoError(err, test.expression)
+		assert.Equal(test.value, val, test.expression)
+	}
+
+	for _, expression := range []string{"", "used /", "(used", "used)", "used % total", "2 3", "et_result[].value", "1x"} {
+		_, err := parseExpr(expression)
+		assert.Error(err, expression)
+	}
+
+	for _, expression := range []string{"used / zero", "used + missing"} {
+		e, err := parseExpr(expression)
+		assert.NoError(err)
+		_, err = e.eval(lookup)
+		assert.Error(err, expression)
+	}
+}
+
+func Test_DerivedData(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t,
+		tomlMetric{
+			Name:           "sap_monitor_memory",
+			Help:           "memory",
+			MetricType:     "gauge",
+			FunctionModule: "Z_MONITOR_INFO",
+			TagFilter:      []string{"test"},
+			StructureData: StructureInfo{
+				ExportStructure: "es_info",
+				StructureFields: []string{"memory.used"},
+				Derived: map[string]string{
+					"Memory_Used_Percent": "MEMORY.USED / MEMORY.TOTAL * 100",
+				},
+			},
+		},
+		tomlMetric{
+			Name:           "sap_monitor_disks",
+			Help:           "disks",
+			MetricType:     "gauge",
+			FunctionModule: "Z_MONITOR_INFO",
+			TagFilter:      []string{"test"},
+			StructureData: StructureInfo{
+				ExportStructure: "es_info.disks[]",
+				Derived: map[string]string{
+					"used_percent": "used / total * 100",
+				},
+			},
+		},
+		tomlMetric{
+			Name:           "sap_monitor_free",
+			Help:           "free memory",
+			MetricType:     "gauge",
+			FunctionModule: "Z_MONITOR_INFO",
+			TagFilter:      []string{"test"},
+			FieldData: FieldInfo{
+				Derived: map[string]string{
+					"memory_free": "es_info.memory.total - es_info.memory.used",
+					"missing":     "es_info.memory.total - es_info.memory.cached",
+				},
+			},
+		},
+	)
+	config.Systems[0].Tags = []string{"test"}
+
+	for _, md := range config.collectMetrics() {
+		switch md.name {
+		case "sap_monitor_memory":
+			assert.Equal(2, len(md.stats))
+			r, _ := findRecord(md.stats, "t01", "memory_used_percent")
+			assert.Equal(75.0, r.value)
+		case "sap_monitor_disks":
+			assert.Equal(2, len(md.stats))
+			r, _ := findRecord(md.stats, "t01", "es_info.disks[0].used_percent")
+			assert.Equal(40.0, r.value)
+			r, _ = findRecord(md.stats, "t01", "es_info.disks[1].used_percent")
+			assert.Equal(10.0, r.value)
+		case "sap_monitor_free":
+			assert.Equal(1, len(md.stats))
+			r, _ := findRecord(md.stats, "t01", "memory_free")
+			assert.Equal(1024.0, r.value)
+		default:
+			t.Error("unexpected metric " + md.name)
+		}
+	}
+
+	// derived values can't be combined with field labels
+	fi := FieldInfo{FieldLabels: []string{"ev_release"}, Derived: map[string]string{"x": "1"}}
+	assert.False(fi.checkSpecialData())
+	fi = FieldInfo{Derived: map[string]string{"x": "1 +"}}
+	assert.False(fi.checkSpecialData())
+}
@@ -0,0 +1,247 @@
+// Copyright © 2020 Ulrich Anhalt <ulrich.anhalt@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// in-process sap backend with canned function module responses
+//
+// responses are stored per system ("t01") or per system application
+// server ("t01_host1") and function module. A server specific entry
+// takes precedence over the system entry.
+type fakeBackend struct {
+	mu        sync.Mutex
+	responses map[string]map[string]map[string]interface{}
+	failures  map[string]error
+	delays    map[string]time.Duration
+	calls     map[string]int
+	connects  int
+	closes    int
+}
+
+// fake rfc connection to one system application server
+type fakeClient struct {
+	backend *fakeBackend
+	keys    []string
+	closed  bool
+}
+
+// create empty fake backend
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{
+		responses: make(map[string]map[string]map[string]interface{}),
+		failures:  make(map[string]error),
+		delays:    make(map[string]time.Duration),
+		calls:     make(map[string]int),
+	}
+}
+
+// load fake backend from a directory with json fixture files
+//
+// the file name without extension is the system or system_server key, the
+// file content is a json object with the function module names as keys and
+// the function module results as values, for example:
+//
+//	{"TH_WPINFO": {"WPLIST": [{"WP_TYP": "DIA", "WP_STATUS": "Running"}]}}
+func loadFakeBackend(dir string) (*fakeBackend, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, errors.Wrap(err, "loadFakeBackend(Glob)")
+	}
+
+	fb := newFakeBackend()
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "loadFakeBackend(ReadFile)")
+		}
+
+		var fixture map[string]map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(content))
+		dec.UseNumber()
+		if err := dec.Decode(&fixture); err != nil {
+			return nil, errors.Wrap(err, "loadFakeBackend(Decode "+filepath.Base(file)+")")
+		}
+
+		key := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		for fm, result := range fixture {
+			fb.set(key, fm, fixtureValue(result).(map[string]interface{}))
+		}
+	}
+	return fb, nil
+}
+
+// add function module result for a system or system_server key
+func (fb *fakeBackend) set(key, functionModule string, result map[string]interface{}) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	if _, ok := fb.responses[low(key)]; !ok {
+		fb.responses[low(key)] = make(map[string]map[string]interface{})
+	}
+	fb.responses[low(key)][up(functionModule)] = result
+}
+
+// let the next call of a function module fail with err
+func (fb *fakeBackend) fail(functionModule string, err error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	fb.failures[up(functionModule)] = err
+}
+
+// let all calls of a system or system_server key take at least d
+func (fb *fakeBackend) delay(key string, d time.Duration) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	fb.delays[low(key)] = d
+}
+
+// number of calls of a function module
+func (fb *fakeBackend) callCount(functionModule string) int {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	return fb.calls[up(functionModule)]
+}
+
+// number of established connections
+func (fb *fakeBackend) connectCount() int {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	return fb.connects
+}
+
+// number of connections, that are not closed
+func (fb *fakeBackend) openCount() int {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	return fb.connects - fb.closes
+}
+
+// connect - rfc connector of the fake backend
+func (fb *fakeBackend) connect(system SystemInfo, password string) (rfcClient, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	var keys []string
+	for _, key := range []string{low(system.Name + "_" + system.Server), low(system.Name)} {
+		if _, ok := fb.responses[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("fakeBackend(no responses for system " + system.Name + ")")
+	}
+
+	fb.connects++
+	return &fakeClient{
+		backend: fb,
+		keys:    keys,
+	}, nil
+}
+
+// Call - return canned function module result
+func (fc *fakeClient) Call(functionModule string, params map[string]interface{}) (map[string]interface{}, error) {
+	fc.backend.mu.Lock()
+	var d time.Duration
+	for _, key := range fc.keys {
+		if fc.backend.delays[key] > d {
+			d = fc.backend.delays[key]
+		}
+	}
+	fc.backend.mu.Unlock()
+	time.Sleep(d)
+
+	fc.backend.mu.Lock()
+	defer fc.backend.mu.Unlock()
+
+	if fc.closed {
+		return nil, errors.New("fakeClient(connection closed)")
+	}
+	fc.backend.calls[up(functionModule)]++
+
+	if err, ok := fc.backend.failures[up(functionModule)]; ok {
+		delete(fc.backend.failures, up(functionModule))
+		return nil, err
+	}
+
+	for _, key := range fc.keys {
+		if result, ok := fc.backend.responses[key][up(functionModule)]; ok {
+			return result, nil
+		}
+	}
+	return nil, errors.New("fakeClient(function module " + functionModule + " not found for " + fc.keys[0] + ")")
+}
+
+// Ping - check fake connection
+func (fc *fakeClient) Ping() error {
+	fc.backend.mu.Lock()
+	defer fc.backend.mu.Unlock()
+
+	if fc.closed {
+		return errors.New("fakeClient(connection closed)")
+	}
+	return nil
+}
+
+// Close - close fake connection
+func (fc *fakeClient) Close() error {
+	fc.backend.mu.Lock()
+	defer fc.backend.mu.Unlock()
+
+	if !fc.closed {
+		fc.backend.closes++
+	}
+	fc.closed = true
+	return nil
+}
+
+// convert decoded json numbers to the go types returned by gorfc
+func fixtureValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = fixtureValue(v[i])
+		}
+		return v
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = fixtureValue(v[k])
+		}
+		return v
+	default:
+		return v
+	}
+}
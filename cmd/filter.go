@@ -0,0 +1,185 @@
+// Copyright © 2020 Ulrich Anhalt <ulrich.anhalt@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FilterInfo - condition a table row must fulfill
+type FilterInfo struct {
+	Field  string
+	Op     string
+	Values []interface{}
+
+	regexps []*regexp.Regexp
+	numbers []float64
+}
+
+// number of values per numeric filter operator
+var numericOps = map[string]int{
+	"gt":      1,
+	"ge":      1,
+	"lt":      1,
+	"le":      1,
+	"between": 2,
+}
+
+// check filter and prepare regular expressions and numbers
+func (fi *FilterInfo) check() bool {
+	fi.Field = low(fi.Field)
+	fi.Op = low(fi.Op)
+	if 0 == len(fi.Op) {
+		fi.Op = "eq"
+	}
+
+	if 0 == len(fi.Field) || 0 == len(fi.Values) {
+		log.WithFields(log.Fields{
+			"Field":  fi.Field,
+			"Values": fi.Values,
+		}).Error("FilterInfo: one or both entries missing")
+		return false
+	}
+
+	switch fi.Op {
+	case "eq", "ne":
+		return true
+	case "regex", "notregex":
+		fi.regexps = nil
+		for _, value := range fi.Values {
+			expr, ok := value.(string)
+			if !ok {
+				log.WithFields(log.Fields{
+					"Field": fi.Field,
+					"Value": value,
+				}).Error("FilterInfo: regular expressions must be strings")
+				return false
+			}
+			re, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"Field": fi.Field,
+					"Value": value,
+					"error": err,
+				}).Error("FilterInfo: wrong regular expression")
+				return false
+			}
+			fi.regexps = append(fi.regexps, re)
+		}
+		return true
+	}
+
+	n, ok := numericOps[fi.Op]
+	if !ok {
+		log.WithFields(log.Fields{
+			"Field": fi.Field,
+			"Op":    fi.Op,
+		}).Error("FilterInfo: Op must be eq, ne, regex, notregex, gt, ge, lt, le or between")
+		return false
+	}
+	if len(fi.Values) != n {
+		log.WithFields(log.Fields{
+			"Field":  fi.Field,
+			"Op":     fi.Op,
+			"Values": fi.Values,
+		}).Error("FilterInfo: wrong number of values")
+		return false
+	}
+	fi.numbers = nil
+	for _, value := range fi.Values {
+		f64Val, err := i2Float64(value)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"Field": fi.Field,
+				"Value": value,
+			}).Error("FilterInfo: numeric filters need numeric values")
+			return false
+		}
+		fi.numbers = append(fi.numbers, f64Val)
+	}
+	return true
+}
+
+// true if the table row fulfills the filter
+func (fi FilterInfo) match(line map[string]interface{}) bool {
+	switch fi.Op {
+	case "eq", "ne":
+		found := false
+		for _, value := range fi.Values {
+			if equalValues(line[up(fi.Field)], value) {
+				found = true
+				break
+			}
+		}
+		return found == ("eq" == fi.Op)
+	case "regex", "notregex":
+		found := false
+		for _, re := range fi.regexps {
+			if re.MatchString(formatValue(line[up(fi.Field)])) {
+				found = true
+				break
+			}
+		}
+		return found == ("regex" == fi.Op)
+	}
+
+	f64Val, err := i2Float64(line[up(fi.Field)])
+	if err != nil {
+		return false
+	}
+	switch fi.Op {
+	case "gt":
+		return f64Val > fi.numbers[0]
+	case "ge":
+		return f64Val >= fi.numbers[0]
+	case "lt":
+		return f64Val < fi.numbers[0]
+	case "le":
+		return f64Val <= fi.numbers[0]
+	case "between":
+		return f64Val >= fi.numbers[0] && f64Val <= fi.numbers[1]
+	}
+	return false
+}
+
+// true if the field value equals the filter value, numeric filter values are
+// compared numerically
+func equalValues(fieldValue, value interface{}) bool {
+	if _, ok := value.(string); !ok {
+		f64Field, err := i2Float64(fieldValue)
+		if err != nil {
+			return false
+		}
+		f64Val, err := i2Float64(value)
+		return err == nil && f64Field == f64Val
+	}
+	return strings.EqualFold(formatValue(fieldValue), value.(string))
+}
+
+// true if the table row fulfills the row filter shorthand and all filters
+func (tMetric TableInfo) rowOK(line map[string]interface{}) bool {
+	if len(tMetric.RowFilter) > 0 && !inFilter(line, tMetric.RowFilter) {
+		return false
+	}
+	for _, fi := range tMetric.Filters {
+		if !fi.match(line) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FilterMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	line := map[string]interface{}{"WP_TYP": "DIA", "WP_STATUS": "Running", "WP_CPU": "12", "WP_ELTIME": 3, "WP_MEM": 1.5}
+
+	tests := []struct {
+		filter FilterInfo
+		ok     bool
+	}{
+		{FilterInfo{Field: "wp_typ", Values: []interface{}{"bgd", "dia"}}, true},
+		{FilterInfo{Field: "wp_typ", Op: "ne", Values: []interface{}{"dia"}}, false},
+		{FilterInfo{Field: "wp_typ", Op: "ne", Values: []interface{}{"bgd", "upd"}}, true},
+		{FilterInfo{Field: "wp_status", Op: "regex", Values: []interface{}{"^run"}}, true},
+		{FilterInfo{Field: "wp_status", Op: "notregex", Values: []interface{}{"wait|hold"}}, true},
+		{FilterInfo{Field: "wp_cpu", Op: "gt", Values: []interface{}{10}}, true},
+		{FilterInfo{Field: "wp_cpu", Op: "lt", Values: []interface{}{"10"}}, false},
+		{FilterInfo{Field: "wp_eltime", Op: "le", Values: []interface{}{3}}, true},
+		{FilterInfo{Field: "wp_eltime", Op: "between", Values: []interface{}{1, 2.5}}, false},
+		{FilterInfo{Field: "wp_typ", Op: "ge", Values: []interface{}{0}}, false},
+		{FilterInfo{Field: "wp_mem", Values: []interface{}{1.5}}, true},
+		{FilterInfo{Field: "wp_mem", Values: []interface{}{"1.5"}}, true},
+		{FilterInfo{Field: "wp_mem", Values: []interface{}{2.5}}, false},
+		{FilterInfo{Field: "wp_mem", Op: "ne", Values: []interface{}{2.5}}, true},
+		{FilterInfo{Field: "wp_cpu", Values: []interface{}{12}}, true},
+		{FilterInfo{Field: "wp_typ", Values: []interface{}{0}}, false},
+		{FilterInfo{Field: "wp_mem", Op: "regex", Values: []interface{}{"^1\\."}}, true},
+		{FilterInfo{Field: "wp_mem", Op: "regex", Values: []interface{}{"^2"}}, false},
+	}
+
+	for _, test := range tests {
+		assert.True(test.filter.check())
+		assert.Equal(test.ok, test.filter.match(line), test.filter)
+	}
+}
+
+func Test_FilterCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, fi := range []FilterInfo{
+		{Op: "eq", Values: []interface{}{"dia"}},
+		{Field: "wp_typ"},
+		{Field: "wp_typ", Op: "like", Values: []interface{}{"dia"}},
+		{Field: "wp_typ", Op: "regex", Values: []interface{}{"(dia"}},
+		{Field: "wp_mem", Op: "regex", Values: []interface{}{1.5}},
+		{Field: "wp_mem", Op: "notregex", Values: []interface{}{"dia", 2}},
+		{Field: "wp_cpu", Op: "between", Values: []interface{}{1}},
+		{Field: "wp_cpu", Op: "gt", Values: []interface{}{"high"}},
+	} {
+		assert.False(fi.check(), fi)
+	}
+}
+
+func Test_TableDataFilters(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t, tomlMetric{
+		Name:           "sap_processes",
+		Help:           "sm50",
+		MetricType:     "gauge",
+		FunctionModule: "TH_WPINFO",
+		TagFilter:      []string{"test"},
+		TableData: TableInfo{
+			Table: "WPLIST",
+			RowCount: map[string][]interface{}{
+				"wp_typ": {"total"},
+			},
+			RowFilter: map[string][]interface{}{
+				"wp_typ": {"dia", "bgd"},
+			},
+			Filters: []FilterInfo{
+				{Field: "wp_status", Op: "ne", Values: []interface{}{"waiting"}},
+				{Field: "wp_cpu", Op: "between", Values: []interface{}{"10", 100}},
+			},
+		},
+	})
+	config.Systems[0].Tags = []string{"test"}
+
+	// only the running dia processes with 12 and 20 cpu seconds are left
+	data := config.collectMetrics()
+	assert.Equal(1, len(data))
+	r, ok := findRecord(data[0].stats, "t01", "wp_typ_total")
+	assert.True(ok)
+	assert.Equal(2.0, r.value)
+}
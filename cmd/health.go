@@ -0,0 +1,86 @@
+// Copyright © 2020 Ulrich Anhalt <ulrich.anhalt@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// exporter self-monitoring metrics
+var (
+	rfcUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sapnwrfc_up",
+			Help: "1 if the application server was reachable at the last rfc call, 0 after a connect or communication error.",
+		},
+		[]string{"system", "server"},
+	)
+	rfcCallDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "sapnwrfc_rfc_call_duration_seconds",
+			Help:    "Duration of the function module calls.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+		},
+		[]string{"system", "server", "function_module"},
+	)
+	rfcErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sapnwrfc_rfc_errors_total",
+			Help: "Number of failed function module calls.",
+		},
+		[]string{"system", "function_module", "reason"},
+	)
+	connectErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sapnwrfc_connect_errors_total",
+			Help: "Number of failed connection attempts.",
+		},
+		[]string{"system", "server"},
+	)
+	scrapeTimeouts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sapnwrfc_scrape_timeouts_total",
+			Help: "Number of metric collections, where the system did not answer within the timeout.",
+		},
+		[]string{"system", "metric"},
+	)
+	scrapeTimedOut = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sapnwrfc_scrape_timed_out",
+			Help: "1 if the system did not answer within the timeout of the last metric collection, otherwise 0.",
+		},
+		[]string{"system", "metric"},
+	)
+)
+
+// register self-monitoring metrics
+func registerHealthMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(rfcUp, rfcCallDuration, rfcErrors, connectErrors, scrapeTimeouts, scrapeTimedOut)
+}
+
+// reason of a failed function module call
+func errorReason(err error) string {
+	switch {
+	case errors.Is(err, errCommunication):
+		return "communication"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return "timeout"
+	default:
+		return "call"
+	}
+}
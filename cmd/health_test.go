@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HealthRfcCalls(t *testing.T) {
+	assert := assert.New(t)
+
+	fb, err := loadFakeBackend("testdata/fixtures")
+	assert.Nil(err)
+	pool := newConnPool(fb.connect, 2, 2, 0)
+	system := SystemInfo{Name: "t01", Server: "health1", Sysnr: "01"}
+
+	_, err = pool.call(context.Background(), system, "pw", "TH_WPINFO", nil)
+	assert.Nil(err)
+	assert.Equal(1.0, testutil.ToFloat64(rfcUp.WithLabelValues("t01", "health1")))
+
+	// abap errors do not change the server state
+	errCnt := testutil.ToFloat64(rfcErrors.WithLabelValues("t01", "TH_WPINFO", "call"))
+	fb.fail("TH_WPINFO", errors.New("function module not released"))
+	_, err = pool.call(context.Background(), system, "pw", "TH_WPINFO", nil)
+	assert.NotNil(err)
+	assert.Equal(errCnt+1, testutil.ToFloat64(rfcErrors.WithLabelValues("t01", "TH_WPINFO", "call")))
+	assert.Equal(1.0, testutil.ToFloat64(rfcUp.WithLabelValues("t01", "health1")))
+
+	// connect errors
+	connectCnt := testutil.ToFloat64(connectErrors.WithLabelValues("unknown", "health2"))
+	system = SystemInfo{Name: "unknown", Server: "health2"}
+	_, err = pool.call(context.Background(), system, "pw", "TH_WPINFO", nil)
+	assert.NotNil(err)
+	assert.Equal(connectCnt+1, testutil.ToFloat64(connectErrors.WithLabelValues("unknown", "health2")))
+	assert.Equal(0.0, testutil.ToFloat64(rfcUp.WithLabelValues("unknown", "health2")))
+}
+
+func Test_HealthTimeouts(t *testing.T) {
+	assert := assert.New(t)
+
+	config, fb := getFakeConfig(t, tomlMetric{
+		Name:           "sap_health_storage",
+		Help:           "storage",
+		MetricType:     "gauge",
+		FunctionModule: "SAPTUNE_GET_STORAGE_INFOS",
+		Timeout:        1,
+		FieldData: FieldInfo{
+			FieldValues: []string{"page_bufsz"},
+		},
+	})
+	fb.delay("t02", 1500*time.Millisecond)
+
+	t01Cnt := testutil.ToFloat64(scrapeTimeouts.WithLabelValues("t01", "sap_health_storage"))
+	t02Cnt := testutil.ToFloat64(scrapeTimeouts.WithLabelValues("t02", "sap_health_storage"))
+	res := config.collectSystemsMetric(0)
+	assert.Equal(1, len(res))
+	assert.NotNil(res["t01"])
+	assert.Equal(t02Cnt+1, testutil.ToFloat64(scrapeTimeouts.WithLabelValues("t02", "sap_health_storage")))
+	assert.Equal(t01Cnt, testutil.ToFloat64(scrapeTimeouts.WithLabelValues("t01", "sap_health_storage")))
+	assert.Equal(1.0, testutil.ToFloat64(scrapeTimedOut.WithLabelValues("t02", "sap_health_storage")))
+	assert.Equal(0.0, testutil.ToFloat64(scrapeTimedOut.WithLabelValues("t01", "sap_health_storage")))
+
+	// the connection of the late t02 call is closed, t01 stays in the pool
+	assert.Eventually(func() bool { return fb.openCount() == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	// t02 answers again
+	fb.delay("t02", 0)
+	res = config.collectSystemsMetric(0)
+	assert.Equal(2, len(res))
+	assert.Equal(0.0, testutil.ToFloat64(scrapeTimedOut.WithLabelValues("t02", "sap_health_storage")))
+}
+
+func Test_CallCanceled(t *testing.T) {
+	assert := assert.New(t)
+
+	fb, err := loadFakeBackend("testdata/fixtures")
+	assert.Nil(err)
+	pool := newConnPool(fb.connect, 2, 2, 0)
+
+	// no connect and no call after ctx is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = pool.call(ctx, poolSystem, "pw", "TH_WPINFO", nil)
+	assert.Equal(context.Canceled, err)
+	assert.Equal(0, fb.connectCount())
+	assert.Equal("timeout", errorReason(err))
+}
@@ -0,0 +1,152 @@
+// Copyright © 2020 Ulrich Anhalt <ulrich.anhalt@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// valid prometheus label name
+var validLabelRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// labels of every metric record
+var standardLabels = []string{"system", "usage", "server"}
+
+// system info fields, that can be used as SystemLabels
+var systemFields = map[string]func(system SystemInfo) string{
+	"client": func(system SystemInfo) string { return system.Client },
+	"lang":   func(system SystemInfo) string { return low(system.Lang) },
+	"tags": func(system SystemInfo) string {
+		var tags []string
+		for _, tag := range system.Tags {
+			tags = append(tags, low(tag))
+		}
+		return strings.Join(tags, ",")
+	},
+}
+
+// true if name is a valid additional label name
+func validLabelName(name string) bool {
+	if !validLabelRe.MatchString(name) || strings.HasPrefix(name, "__") {
+		return false
+	}
+	for _, label := range standardLabels {
+		if label == name {
+			return false
+		}
+	}
+	return true
+}
+
+// check and lowercase additional label names
+func checkLabelNames(labels map[string]string) (map[string]string, error) {
+	checked := make(map[string]string)
+	for name, value := range labels {
+		if !validLabelName(low(name)) {
+			log.WithFields(log.Fields{
+				"label": name,
+			}).Error("Wrong label name - only letters, digits and underscores are allowed, system, usage and server are reserved")
+			return nil, errors.New("checkLabelNames(" + name + ")")
+		}
+		checked[low(name)] = value
+	}
+	return checked, nil
+}
+
+// check the system labels
+func (config *Config) checkSystemLabels() error {
+	for i, field := range config.SystemLabels {
+		if _, ok := systemFields[low(field)]; !ok {
+			log.WithFields(log.Fields{
+				"field": field,
+			}).Error("SystemLabels: only client, lang and tags are allowed")
+			return errors.New("checkSystemLabels(" + field + ")")
+		}
+		config.SystemLabels[i] = low(field)
+	}
+
+	for i := range config.Systems {
+		labels, err := checkLabelNames(config.Systems[i].Labels)
+		if err != nil {
+			return errors.Wrap(err, "checkSystemLabels("+config.Systems[i].Name+")")
+		}
+		for name := range labels {
+			if _, ok := systemFields[name]; ok {
+				return errors.New("checkSystemLabels(" + config.Systems[i].Name + " label " + name + " is a system field)")
+			}
+		}
+		config.Systems[i].Labels = labels
+	}
+	config.sysLabels = config.systemLabelNames()
+	return nil
+}
+
+// names of the system labels, the union of the labels of all systems
+func (config *Config) systemLabelNames() []string {
+	names := append([]string{}, config.SystemLabels...)
+	known := make(map[string]bool)
+	for _, system := range config.Systems {
+		for name := range system.Labels {
+			if !known[name] {
+				known[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names[len(config.SystemLabels):])
+	return names
+}
+
+// add system labels and const labels of the metric to the records
+// clashes with the labels of the records are rejected by checkMetricLabels
+func (config *Config) addLabels(records []metricRecord, mPos, sPos int) []metricRecord {
+	system := config.Systems[sPos]
+
+	var names, values []string
+	for _, name := range config.sysLabels {
+		names = append(names, name)
+		if field, ok := systemFields[name]; ok {
+			values = append(values, field(system))
+		} else {
+			values = append(values, system.Labels[name])
+		}
+	}
+
+	constLabels := config.IntMetrics[mPos].ConstLabels
+	var constNames []string
+	for name := range constLabels {
+		constNames = append(constNames, name)
+	}
+	sort.Strings(constNames)
+	for _, name := range constNames {
+		names = append(names, name)
+		values = append(values, constLabels[name])
+	}
+
+	if 0 == len(names) {
+		return records
+	}
+
+	for i := range records {
+		records[i].labels = append(append([]string{}, records[i].labels...), names...)
+		records[i].labelValues = append(append([]string{}, records[i].labelValues...), values...)
+	}
+	return records
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AdditionalLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t, tomlMetric{
+		Name:           "sap_tune_storage_infos",
+		Help:           "storage",
+		MetricType:     "gauge",
+		FunctionModule: "SAPTUNE_GET_STORAGE_INFOS",
+		ConstLabels:    map[string]string{"Team": "basis"},
+		FieldData: FieldInfo{
+			FieldValues: []string{"page_bufsz"},
+		},
+	})
+	config.SystemLabels = []string{"Client", "tags"}
+	config.Systems[0].Labels = map[string]string{"Datacenter": "dc1"}
+	config.Systems[1].Labels = map[string]string{"landscape": "erp", "datacenter": "dc2"}
+	assert.NoError(config.checkSystemLabels())
+	assert.NoError(config.checkMetricLabels())
+
+	// t01 has no landscape label
+	expected := `
+# HELP sap_tune_storage_infos storage
+# TYPE sap_tune_storage_infos gauge
+sap_tune_storage_infos{client="100",datacenter="dc1",field="page_bufsz",landscape="",server="t01",system="t01",tags="",team="basis",usage="test"} 1024
+sap_tune_storage_infos{client="100",datacenter="dc2",field="page_bufsz",landscape="erp",server="t02",system="t02",tags="erp",team="basis",usage="prod"} 2048
+`
+	c := newCollector(config.collectMetrics)
+	assert.NoError(testutil.CollectAndCompare(c, strings.NewReader(expected)))
+}
+
+func Test_CheckLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, name := range []string{"datacenter", "Land_Scape2", "_x"} {
+		assert.True(validLabelName(low(name)), name)
+	}
+	for _, name := range []string{"", "system", "usage", "server", "__name", "data-center", "1dc"} {
+		assert.False(validLabelName(name), name)
+	}
+
+	config := &Config{SystemLabels: []string{"password"}}
+	assert.Error(config.checkSystemLabels())
+	config = &Config{Systems: []SystemInfo{{Name: "t01", Labels: map[string]string{"server": "x"}}}}
+	assert.Error(config.checkSystemLabels())
+	config = &Config{Systems: []SystemInfo{{Name: "t01", Labels: map[string]string{"client": "x"}}}}
+	assert.Error(config.checkSystemLabels())
+
+	// system and const labels must not clash with the labels of the data
+	config, _ = getFakeConfig(t, tomlMetric{
+		Name:           "sap_tune_storage_infos",
+		Help:           "storage",
+		MetricType:     "gauge",
+		FunctionModule: "SAPTUNE_GET_STORAGE_INFOS",
+		ConstLabels:    map[string]string{"field": "x"},
+		FieldData:      FieldInfo{FieldValues: []string{"page_bufsz"}},
+	})
+	assert.NoError(config.checkSystemLabels())
+	assert.Error(config.checkMetricLabels())
+	config.IntMetrics[0].ConstLabels = nil
+	config.Systems[0].Labels = map[string]string{"field": "x"}
+	assert.NoError(config.checkSystemLabels())
+	assert.Error(config.checkMetricLabels())
+
+	_, err := checkTomlMetric(tomlMetric{
+		Name:           "sap_tune_storage_infos",
+		Help:           "storage",
+		MetricType:     "gauge",
+		FunctionModule: "SAPTUNE_GET_STORAGE_INFOS",
+		ConstLabels:    map[string]string{"usage": "x"},
+		FieldData:      FieldInfo{FieldValues: []string{"page_bufsz"}},
+	})
+	assert.Error(err)
+}
@@ -0,0 +1,134 @@
+// Copyright © 2020 Ulrich Anhalt <ulrich.anhalt@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// path of nested result data, e.g. "INFO.MEMORY.USED" or "ET_RESULT[].VALUE"
+var pathRe = regexp.MustCompile(`^[^.\[\]]+(\[\d*\])?(\.[^.\[\]]+(\[\d*\])?)*$`)
+
+// characters, that are not allowed in prometheus label names
+var labelNameRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// value of a path in the function module result
+type pathValue struct {
+	path  string
+	value interface{}
+}
+
+// true if path has a valid syntax
+func validPath(path string) bool {
+	return pathRe.MatchString(path)
+}
+
+// all values of the path in the function module result
+// [] stands for all rows of a table and [n] for row n, the paths of the
+// returned values contain the row numbers
+func resolvePath(data map[string]interface{}, path string) []pathValue {
+	values := []pathValue{{"", data}}
+
+	for _, segment := range strings.Split(path, ".") {
+		name, index, isTable := splitSegment(segment)
+
+		var next []pathValue
+		for _, pv := range values {
+			m, ok := pv.value.(map[string]interface{})
+			if !ok || m[up(name)] == nil {
+				continue
+			}
+
+			p := low(name)
+			if len(pv.path) > 0 {
+				p = pv.path + "." + p
+			}
+			if !isTable {
+				next = append(next, pathValue{p, m[up(name)]})
+				continue
+			}
+
+			rows, ok := m[up(name)].([]interface{})
+			if !ok {
+				continue
+			}
+			for i, row := range rows {
+				if index >= 0 && i != index {
+					continue
+				}
+				next = append(next, pathValue{p + "[" + strconv.Itoa(i) + "]", row})
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// name and row index of a path segment, index is -1 for all rows
+func splitSegment(segment string) (string, int, bool) {
+	pos := strings.Index(segment, "[")
+	if pos < 0 {
+		return segment, -1, false
+	}
+
+	index, err := strconv.Atoi(segment[pos+1 : len(segment)-1])
+	if err != nil {
+		index = -1
+	}
+	return segment[:pos], index, true
+}
+
+// rows of the tables found with the path
+func tableRows(rawData map[string]interface{}, path string) ([]map[string]interface{}, bool) {
+	values := resolvePath(rawData, path)
+	if 0 == len(values) {
+		return nil, false
+	}
+
+	var rows []map[string]interface{}
+	for _, pv := range values {
+		switch val := pv.value.(type) {
+		case []interface{}:
+			for _, row := range val {
+				if line, ok := row.(map[string]interface{}); ok {
+					rows = append(rows, line)
+				}
+			}
+		case map[string]interface{}:
+			rows = append(rows, val)
+		}
+	}
+	return rows, true
+}
+
+// valid prometheus label name of a field or path
+func labelName(field string) string {
+	name := labelNameRe.ReplaceAllString(low(field), "_")
+	if len(name) > 0 && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// valid prometheus label names of fields or paths
+func labelNames(fields []string) []string {
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, labelName(field))
+	}
+	return names
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ResolvePath(t *testing.T) {
+	assert := assert.New(t)
+
+	fb, err := loadFakeBackend("testdata/fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawData := fb.responses["t01"]["Z_MONITOR_INFO"]
+
+	tests := []struct {
+		path   string
+		values []pathValue
+	}{
+		{"ES_INFO.MEMORY.USED", []pathValue{{"es_info.memory.used", 3072}}},
+		{"es_info.disks[].used", []pathValue{{"es_info.disks[0].used", 40}, {"es_info.disks[1].used", 5}}},
+		{"ES_INFO.DISKS[1].NAME", []pathValue{{"es_info.disks[1].name", "/sapmnt"}}},
+		{"ET_RESULT[].ENTRIES[].STATE", []pathValue{
+			{"et_result[0].entries[0].state", "READY"},
+			{"et_result[0].entries[1].state", "SYSFAIL"},
+			{"et_result[1].entries[0].state", "READY"},
+		}},
+		{"ES_INFO.MEMORY.FREE", nil},
+		{"ES_INFO.HOST.NAME", nil},
+		{"ES_INFO.DISKS[5].NAME", nil},
+	}
+	for _, test := range tests {
+		assert.Equal(test.values, resolvePath(rawData, test.path), test.path)
+	}
+
+	rows, ok := tableRows(rawData, "ET_RESULT[].ENTRIES")
+	assert.True(ok)
+	assert.Equal(3, len(rows))
+	_, ok = tableRows(rawData, "ET_MISSING")
+	assert.False(ok)
+}
+
+func Test_ValidPath(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, path := range []string{"PAGE_BUFSZ", "INFO.MEMORY.USED", "ET_RESULT[].VALUE", "ET_RESULT[2].VALUE", "/BDL/INFO.USED"} {
+		assert.True(validPath(path), path)
+	}
+	for _, path := range []string{"", "INFO..USED", "INFO.", "ET_RESULT[x].VALUE", "ET_RESULT[]VALUE"} {
+		assert.False(validPath(path), path)
+	}
+}
+
+func Test_FieldLabelPaths(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True((&FieldInfo{FieldLabels: []string{"es_info.host", "et_result[0].value"}}).checkSpecialData())
+	assert.False((&FieldInfo{FieldLabels: []string{"et_result[].value"}}).checkSpecialData())
+	assert.True((&FieldInfo{FieldValues: []string{"et_result[].value"}}).checkSpecialData())
+}
+
+func Test_LabelName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("wp_typ", labelName("WP_TYP"))
+	assert.Equal("es_info_memory_used", labelName("es_info.memory.used"))
+	assert.Equal("_bdl_host", labelName("/BDL/HOST"))
+	assert.Equal("_1st", labelName("1st"))
+}
+
+func Test_NestedData(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t,
+		tomlMetric{
+			Name:           "sap_monitor_values",
+			Help:           "nested field values",
+			MetricType:     "gauge",
+			FunctionModule: "Z_MONITOR_INFO",
+			TagFilter:      []string{"test"},
+			FieldData: FieldInfo{
+				FieldValues: []string{"ES_INFO.MEMORY.USED", "et_result[].value"},
+			},
+		},
+		tomlMetric{
+			Name:           "sap_monitor_info",
+			Help:           "nested field labels",
+			MetricType:     "gauge",
+			FunctionModule: "Z_MONITOR_INFO",
+			TagFilter:      []string{"test"},
+			FieldData: FieldInfo{
+				FieldLabels: []string{"es_info.host", "es_info.disks[0].name"},
+			},
+		},
+		tomlMetric{
+			Name:           "sap_monitor_disks",
+			Help:           "nested structures",
+			MetricType:     "gauge",
+			FunctionModule: "Z_MONITOR_INFO",
+			TagFilter:      []string{"test"},
+			StructureData: StructureInfo{
+				ExportStructure: "ES_INFO.DISKS[]",
+				StructureFields: []string{"used"},
+			},
+		},
+		tomlMetric{
+			Name:           "sap_monitor_memory",
+			Help:           "nested structure",
+			MetricType:     "gauge",
+			FunctionModule: "Z_MONITOR_INFO",
+			TagFilter:      []string{"test"},
+			StructureData: StructureInfo{
+				ExportStructure: "ES_INFO",
+				StructureFields: []string{"memory.total"},
+			},
+		},
+		tomlMetric{
+			Name:           "sap_monitor_entries",
+			Help:           "nested table",
+			MetricType:     "gauge",
+			FunctionModule: "Z_MONITOR_INFO",
+			TagFilter:      []string{"test"},
+			TableData: TableInfo{
+				Table: "ET_RESULT[].ENTRIES",
+				RowCount: map[string][]interface{}{
+					"state": {"ready", "sysfail"},
+				},
+			},
+		},
+	)
+	config.Systems[0].Tags = []string{"test"}
+
+	data := config.collectMetrics()
+	assert.Equal(5, len(data))
+	for _, md := range data {
+		switch md.name {
+		case "sap_monitor_values":
+			assert.Equal(3, len(md.stats))
+			r, _ := findRecord(md.stats, "t01", "es_info.memory.used")
+			assert.Equal(3072.0, r.value)
+			r, _ = findRecord(md.stats, "t01", "et_result[1].value")
+			assert.Equal(2.0, r.value)
+		case "sap_monitor_info":
+			assert.Equal(1, len(md.stats))
+			assert.Equal([]string{"system", "usage", "server", "es_info_host", "es_info_disks_0__name"}, md.stats[0].labels)
+			assert.Equal([]string{"t01", "test", "t01", "host1", "/usr/sap"}, md.stats[0].labelValues)
+		case "sap_monitor_disks":
+			assert.Equal(2, len(md.stats))
+			r, _ := findRecord(md.stats, "t01", "es_info.disks[0].used")
+			assert.Equal(40.0, r.value)
+			r, _ = findRecord(md.stats, "t01", "es_info.disks[1].used")
+			assert.Equal(5.0, r.value)
+		case "sap_monitor_memory":
+			assert.Equal(1, len(md.stats))
+			r, _ := findRecord(md.stats, "t01", "memory.total")
+			assert.Equal(4096.0, r.value)
+		case "sap_monitor_entries":
+			r, _ := findRecord(md.stats, "t01", "state_ready")
+			assert.Equal(2.0, r.value)
+			r, _ = findRecord(md.stats, "t01", "state_sysfail")
+			assert.Equal(1.0, r.value)
+		default:
+			t.Error("unexpected metric " + md.name)
+		}
+	}
+}
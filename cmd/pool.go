@@ -0,0 +1,277 @@
+// Copyright © 2020 Ulrich Anhalt <ulrich.anhalt@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// idle connections older than this are pinged before they are used again
+const poolPingAfter = time.Minute
+
+// long-lived rfc connections per system application server
+type connPool struct {
+	mu          sync.Mutex
+	free        *sync.Cond
+	connector   rfcConnector
+	maxOpen     int
+	maxIdle     int
+	maxLifetime time.Duration
+	idle        map[string][]*poolConn
+	open        map[string]int
+	closed      bool
+}
+
+// pooled rfc connection
+type poolConn struct {
+	rfcClient
+	key      string
+	created  time.Time
+	lastUsed time.Time
+}
+
+// create connection pool, maxOpen 0 means unlimited
+// maxIdle is raised to maxOpen, so open connections are never closed as surplus
+func newConnPool(connector rfcConnector, maxOpen, maxIdle int, maxLifetime time.Duration) *connPool {
+	if maxIdle < maxOpen {
+		maxIdle = maxOpen
+	}
+	p := &connPool{
+		connector:   connector,
+		maxOpen:     maxOpen,
+		maxIdle:     maxIdle,
+		maxLifetime: maxLifetime,
+		idle:        make(map[string][]*poolConn),
+		open:        make(map[string]int),
+	}
+	p.free = sync.NewCond(&p.mu)
+	return p
+}
+
+// pool key of a system application server
+func poolKey(system SystemInfo) string {
+	return low(system.Name) + "_" + low(system.Server) + "_" + system.Sysnr
+}
+
+// return a healthy idle connection or open a new one
+// with maxOpen open connections the caller waits for a free one
+func (p *connPool) get(system SystemInfo, password string) (*poolConn, error) {
+	key := poolKey(system)
+
+	for {
+		p.mu.Lock()
+		n := len(p.idle[key])
+		if n == 0 {
+			if p.maxOpen > 0 && p.open[key] >= p.maxOpen {
+				p.free.Wait()
+				p.mu.Unlock()
+				continue
+			}
+			p.open[key]++
+			p.mu.Unlock()
+			break
+		}
+		pc := p.idle[key][n-1]
+		p.idle[key] = p.idle[key][:n-1]
+		p.mu.Unlock()
+
+		if p.expired(pc) {
+			p.discard(pc)
+			continue
+		}
+		if time.Since(pc.lastUsed) > poolPingAfter {
+			if err := pc.Ping(); err != nil {
+				log.WithFields(log.Fields{
+					"system": system.Name,
+					"server": system.Server,
+					"error":  err,
+				}).Info("Pooled connection is broken - reconnect")
+				p.discard(pc)
+				continue
+			}
+		}
+		return pc, nil
+	}
+
+	c, err := p.connector(system, password)
+	if err != nil {
+		p.release(key)
+		connectErrors.WithLabelValues(system.Name, system.Server).Inc()
+		rfcUp.WithLabelValues(system.Name, system.Server).Set(0)
+		return nil, err
+	}
+	now := time.Now()
+	return &poolConn{
+		rfcClient: c,
+		key:       key,
+		created:   now,
+		lastUsed:  now,
+	}, nil
+}
+
+// give connection back to the pool
+// broken, expired and surplus connections are closed
+func (p *connPool) put(pc *poolConn, err error) {
+	if errors.Is(err, errCommunication) || p.expired(pc) {
+		p.discard(pc)
+		return
+	}
+	pc.lastUsed = time.Now()
+
+	p.mu.Lock()
+	if p.closed || len(p.idle[pc.key]) >= p.maxIdle {
+		p.mu.Unlock()
+		p.discard(pc)
+		return
+	}
+	p.idle[pc.key] = append(p.idle[pc.key], pc)
+	p.free.Broadcast()
+	p.mu.Unlock()
+}
+
+// close connection and free its place for waiting callers
+func (p *connPool) discard(pc *poolConn) {
+	pc.Close()
+	p.release(pc.key)
+}
+
+// decrease the number of open connections of key
+func (p *connPool) release(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.open[key]--
+	p.free.Broadcast()
+}
+
+// call function module with a pooled connection
+// after a communication error the call is repeated once with a new connection
+func (p *connPool) call(ctx context.Context, system SystemInfo, password, functionModule string, params map[string]interface{}) (map[string]interface{}, error) {
+	var res map[string]interface{}
+	var err error
+
+	for try := 0; try < 2; try++ {
+		var pc *poolConn
+		pc, err = p.getContext(ctx, system, password)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err = p.callContext(ctx, pc, system, functionModule, params)
+		if err != nil {
+			rfcErrors.WithLabelValues(system.Name, functionModule, errorReason(err)).Inc()
+		}
+		if !errors.Is(err, errCommunication) {
+			break
+		}
+		log.WithFields(log.Fields{
+			"system":          system.Name,
+			"server":          system.Server,
+			"function module": functionModule,
+			"error":           err,
+		}).Info("Rfc communication error - reconnect")
+	}
+	return res, err
+}
+
+// return a pooled connection, unless ctx is done before
+// a connection returned after ctx is done is given back to the pool
+func (p *connPool) getContext(ctx context.Context, system SystemInfo, password string) (*poolConn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type getResult struct {
+		pc  *poolConn
+		err error
+	}
+	resC := make(chan getResult, 1)
+	go func() {
+		pc, err := p.get(system, password)
+		resC <- getResult{pc, err}
+	}()
+
+	select {
+	case r := <-resC:
+		return r.pc, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-resC; r.pc != nil {
+				p.put(r.pc, nil)
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// call function module, unless ctx is done before
+// the connection of a call that returns after ctx is done will be closed,
+// otherwise it is given back to the pool
+func (p *connPool) callContext(ctx context.Context, pc *poolConn, system SystemInfo, functionModule string, params map[string]interface{}) (map[string]interface{}, error) {
+	type callResult struct {
+		res map[string]interface{}
+		err error
+	}
+	resC := make(chan callResult, 1)
+	go func() {
+		start := time.Now()
+		res, err := pc.Call(functionModule, params)
+		rfcCallDuration.WithLabelValues(system.Name, system.Server, functionModule).Observe(time.Since(start).Seconds())
+		if errors.Is(err, errCommunication) {
+			rfcUp.WithLabelValues(system.Name, system.Server).Set(0)
+		} else {
+			rfcUp.WithLabelValues(system.Name, system.Server).Set(1)
+		}
+		resC <- callResult{res, err}
+	}()
+
+	select {
+	case r := <-resC:
+		p.put(pc, r.err)
+		return r.res, r.err
+	case <-ctx.Done():
+		go func() {
+			<-resC
+			p.discard(pc)
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// true if the connection exceeded its max lifetime
+func (p *connPool) expired(pc *poolConn) bool {
+	return p.maxLifetime > 0 && time.Since(pc.created) > p.maxLifetime
+}
+
+// close all idle connections
+func (p *connPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, conns := range p.idle {
+		for _, pc := range conns {
+			pc.Close()
+		}
+		p.open[key] -= len(conns)
+		delete(p.idle, key)
+	}
+	p.closed = true
+	p.free.Broadcast()
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+var poolSystem = SystemInfo{Name: "t01", Server: "host1", Sysnr: "01"}
+
+func Test_PoolReuse(t *testing.T) {
+	assert := assert.New(t)
+
+	fb, err := loadFakeBackend("testdata/fixtures")
+	assert.Nil(err)
+	pool := newConnPool(fb.connect, 0, 1, 0)
+
+	for i := 0; i < 3; i++ {
+		_, err = pool.call(context.Background(), poolSystem, "pw", "TH_WPINFO", nil)
+		assert.Nil(err)
+	}
+	assert.Equal(1, fb.connectCount())
+	assert.Equal(3, fb.callCount("TH_WPINFO"))
+
+	// surplus connections are closed
+	pc1, err := pool.get(poolSystem, "pw")
+	assert.Nil(err)
+	pc2, err := pool.get(poolSystem, "pw")
+	assert.Nil(err)
+	assert.Equal(2, fb.connectCount())
+	pool.put(pc1, nil)
+	pool.put(pc2, nil)
+	assert.Equal(1, len(pool.idle[poolKey(poolSystem)]))
+	assert.NotNil(pc2.Ping())
+
+	pool.close()
+	assert.Equal(0, len(pool.idle))
+	assert.NotNil(pc1.Ping())
+}
+
+func Test_PoolReconnect(t *testing.T) {
+	assert := assert.New(t)
+
+	fb, err := loadFakeBackend("testdata/fixtures")
+	assert.Nil(err)
+	pool := newConnPool(fb.connect, 2, 2, 0)
+
+	_, err = pool.call(context.Background(), poolSystem, "pw", "TH_WPINFO", nil)
+	assert.Nil(err)
+
+	// communication error -> new connection and second call
+	fb.fail("TH_WPINFO", errors.Wrap(errCommunication, "connection reset"))
+	res, err := pool.call(context.Background(), poolSystem, "pw", "TH_WPINFO", nil)
+	assert.Nil(err)
+	assert.NotNil(res["WPLIST"])
+	assert.Equal(2, fb.connectCount())
+	assert.Equal(3, fb.callCount("TH_WPINFO"))
+
+	// other errors are returned and the connection is kept
+	fb.fail("TH_WPINFO", errors.New("function module not released"))
+	_, err = pool.call(context.Background(), poolSystem, "pw", "TH_WPINFO", nil)
+	assert.NotNil(err)
+	assert.Equal(2, fb.connectCount())
+	assert.Equal(1, len(pool.idle[poolKey(poolSystem)]))
+}
+
+func Test_PoolLifetime(t *testing.T) {
+	assert := assert.New(t)
+
+	fb, err := loadFakeBackend("testdata/fixtures")
+	assert.Nil(err)
+	pool := newConnPool(fb.connect, 2, 2, time.Hour)
+
+	pc, err := pool.get(poolSystem, "pw")
+	assert.Nil(err)
+	pool.put(pc, nil)
+
+	// expired connection is closed and replaced
+	pc.created = time.Now().Add(-2 * time.Hour)
+	pc2, err := pool.get(poolSystem, "pw")
+	assert.Nil(err)
+	assert.NotEqual(pc, pc2)
+	assert.NotNil(pc.Ping())
+	assert.Equal(2, fb.connectCount())
+
+	// broken idle connection is detected by ping
+	pool.put(pc2, nil)
+	pc2.lastUsed = time.Now().Add(-2 * poolPingAfter)
+	pc2.Close()
+	pc3, err := pool.get(poolSystem, "pw")
+	assert.Nil(err)
+	assert.NotEqual(pc2, pc3)
+	assert.Equal(3, fb.connectCount())
+}
+
+func Test_PoolMaxOpen(t *testing.T) {
+	assert := assert.New(t)
+
+	fb, err := loadFakeBackend("testdata/fixtures")
+	assert.Nil(err)
+	pool := newConnPool(fb.connect, 1, 0, 0)
+	assert.Equal(1, pool.maxIdle)
+
+	// the second caller waits for the connection of the first one
+	pc1, err := pool.get(poolSystem, "pw")
+	assert.Nil(err)
+	pcC := make(chan *poolConn)
+	go func() {
+		pc, _ := pool.get(poolSystem, "pw")
+		pcC <- pc
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(1, fb.connectCount())
+	pool.put(pc1, nil)
+	assert.Equal(pc1, <-pcC)
+	assert.Equal(1, fb.connectCount())
+
+	// a closed connection frees its place
+	pool.put(pc1, errCommunication)
+	pc2, err := pool.get(poolSystem, "pw")
+	assert.Nil(err)
+	assert.NotEqual(pc1, pc2)
+	assert.Equal(2, fb.connectCount())
+}
+
+func Test_PoolSharedByMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	var metrics []tomlMetric
+	for i := 0; i < 10; i++ {
+		metrics = append(metrics, tomlMetric{
+			Name:           fmt.Sprintf("sap_tune_storage_infos_%d", i),
+			Help:           "storage",
+			MetricType:     "gauge",
+			FunctionModule: "SAPTUNE_GET_STORAGE_INFOS",
+			AllServers:     true,
+			FieldData: FieldInfo{
+				FieldValues: []string{"page_bufsz"},
+			},
+		})
+	}
+	config, fb := getFakeConfig(t, metrics...)
+	fb.delay("t01", 20*time.Millisecond)
+	fb.delay("t02", 20*time.Millisecond)
+
+	// concurrent metrics wait for the open connections instead of logging on again
+	config.collectMetrics()
+	cnt := fb.connectCount()
+	calls := fb.callCount("SAPTUNE_GET_STORAGE_INFOS")
+	assert.True(cnt <= len(config.pool.open)*config.pool.maxOpen, cnt)
+	config.collectMetrics()
+	config.collectMetrics()
+	assert.Equal(cnt, fb.connectCount())
+	assert.Equal(cnt, fb.openCount())
+	assert.Equal(3*calls, fb.callCount("SAPTUNE_GET_STORAGE_INFOS"))
+}
@@ -0,0 +1,102 @@
+// Copyright © 2020 Ulrich Anhalt <ulrich.anhalt@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// probe the metrics of one system in the blackbox exporter style:
+//
+//	/probe?system=<name>&module=<group or metric>[,<group or metric>...]
+//
+// without module all metrics of the system are collected
+func (config *Config) probeHandler(w http.ResponseWriter, r *http.Request) {
+	system := config.FindSystem(r.URL.Query().Get("system"))
+	if "" == system.Name {
+		http.Error(w, "unknown or missing system parameter", http.StatusBadRequest)
+		return
+	}
+
+	metrics := config.selectMetrics(r.URL.Query().Get("module"))
+	if len(metrics) == 0 {
+		http.Error(w, "no metrics found for module parameter", http.StatusBadRequest)
+		return
+	}
+
+	// collect fresh data of the system with the shared connections and servers
+	probe := *config
+	probe.Systems = []SystemInfo{system}
+	probe.IntMetrics = metrics
+	probe.snapshots = nil
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(newCollector(probe.collectMetrics))
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// serve all metrics with the default handler or only the metrics of some
+// groups and the sapnwrfc_* self-monitoring metrics:
+//
+//	/metrics?group=<group or metric>[,<group or metric>...]
+func (config *Config) metricsHandler(all http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		group := r.URL.Query().Get("group")
+		if "" == strings.TrimSpace(group) {
+			all.ServeHTTP(w, r)
+			return
+		}
+
+		metrics := config.selectMetrics(group)
+		if len(metrics) == 0 {
+			http.Error(w, "no metrics found for group parameter", http.StatusBadRequest)
+			return
+		}
+
+		// the exporter self-monitoring is served with every group
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(newCollector(config.metricStats(metrics)))
+		registerHealthMetrics(reg)
+		if config.servers != nil {
+			reg.MustRegister(config.servers)
+		}
+		if config.snapshots != nil {
+			reg.MustRegister(config.snapshots)
+		}
+		promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
+
+// metrics of a comma separated list of group or metric names
+func (config *Config) selectMetrics(selection string) []metricInfo {
+	if "" == strings.TrimSpace(selection) {
+		return config.IntMetrics
+	}
+
+	var metrics []metricInfo
+	for _, mi := range config.IntMetrics {
+		for _, name := range strings.Split(selection, ",") {
+			if low(name) == mi.Name || subSliceInSlice([]string{low(name)}, mi.Groups) {
+				metrics = append(metrics, mi)
+				break
+			}
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func probe(config *Config, query string) (int, string) {
+	rec := httptest.NewRecorder()
+	config.probeHandler(rec, httptest.NewRequest("GET", "/probe?"+query, nil))
+	body, _ := ioutil.ReadAll(rec.Result().Body)
+	return rec.Code, string(body)
+}
+
+func Test_Probe(t *testing.T) {
+	assert := assert.New(t)
+
+	config, fb := getFakeConfig(t, tomlMetric{
+		Name:           "sap_tune_storage_infos",
+		Help:           "storage",
+		MetricType:     "gauge",
+		FunctionModule: "SAPTUNE_GET_STORAGE_INFOS",
+		FieldData: FieldInfo{
+			FieldValues: []string{"page_bufsz"},
+		},
+	}, tomlMetric{
+		Name:           "sap_stapi_version",
+		Help:           "st-a/pi",
+		MetricType:     "gauge",
+		FunctionModule: "ANST_OCS_GET_COMPONENT_STATE",
+		FieldData: FieldInfo{
+			FieldLabels: []string{"ev_comp_rel"},
+		},
+	})
+
+	// all metrics of one system
+	code, body := probe(config, "system=T01")
+	assert.Equal(http.StatusOK, code)
+	assert.True(strings.Contains(body, `sap_tune_storage_infos{field="page_bufsz",server="t01",system="t01",usage="test"} 1024`))
+	assert.True(strings.Contains(body, `sap_stapi_version{ev_comp_rel="01t_731",server="t01",system="t01",usage="test"} 1`))
+	assert.False(strings.Contains(body, `system="t02"`))
+
+	// subset of metrics
+	code, body = probe(config, "system=t02&module=sap_tune_storage_infos")
+	assert.Equal(http.StatusOK, code)
+	assert.True(strings.Contains(body, `system="t02"`))
+	assert.False(strings.Contains(body, "sap_stapi_version"))
+	assert.Equal(1, fb.callCount("ANST_OCS_GET_COMPONENT_STATE"))
+
+	// errors
+	code, _ = probe(config, "system=t09")
+	assert.Equal(http.StatusBadRequest, code)
+	code, _ = probe(config, "system=t01&module=unknown")
+	assert.Equal(http.StatusBadRequest, code)
+}
+
+func Test_MetricGroups(t *testing.T) {
+	assert := assert.New(t)
+
+	config, fb := getFakeConfig(t, tomlMetric{
+		Name:           "sap_tune_storage_infos",
+		Help:           "storage",
+		MetricType:     "gauge",
+		Groups:         []string{"Tune", "memory"},
+		FunctionModule: "SAPTUNE_GET_STORAGE_INFOS",
+		FieldData: FieldInfo{
+			FieldValues: []string{"page_bufsz"},
+		},
+	}, tomlMetric{
+		Name:           "sap_stapi_version",
+		Help:           "st-a/pi",
+		MetricType:     "gauge",
+		Groups:         []string{"versions"},
+		FunctionModule: "ANST_OCS_GET_COMPONENT_STATE",
+		FieldData: FieldInfo{
+			FieldLabels: []string{"ev_comp_rel"},
+		},
+	})
+
+	all := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("all"))
+	})
+	get := func(query string) (int, string) {
+		rec := httptest.NewRecorder()
+		config.metricsHandler(all)(rec, httptest.NewRequest("GET", "/metrics?"+query, nil))
+		body, _ := ioutil.ReadAll(rec.Result().Body)
+		return rec.Code, string(body)
+	}
+
+	_, body := get("")
+	assert.Equal("all", body)
+
+	code, body := get("group=tune")
+	assert.Equal(http.StatusOK, code)
+	assert.True(strings.Contains(body, "# TYPE sap_tune_storage_infos"))
+	assert.False(strings.Contains(body, "# TYPE sap_stapi_version"))
+	assert.True(strings.Contains(body, "# TYPE sapnwrfc_up"))
+	assert.True(strings.Contains(body, "# TYPE sapnwrfc_rfc_call_duration_seconds"))
+	assert.Equal(0, fb.callCount("ANST_OCS_GET_COMPONENT_STATE"))
+
+	code, body = get("group=versions,memory")
+	assert.Equal(http.StatusOK, code)
+	assert.True(strings.Contains(body, "sap_tune_storage_infos"))
+	assert.True(strings.Contains(body, "sap_stapi_version"))
+
+	code, _ = get("group=locks")
+	assert.Equal(http.StatusBadRequest, code)
+
+	// groups can be probed as module
+	code, body = probe(config, "system=t01&module=versions")
+	assert.Equal(http.StatusOK, code)
+	assert.True(strings.Contains(body, "sap_stapi_version"))
+	assert.False(strings.Contains(body, "sap_tune_storage_infos"))
+}
@@ -106,7 +106,7 @@ func (config *Config) SetPw(cmd *cobra.Command) error {
 				"system": s.Name,
 			}).Error("no password found for system")
 		}
-		conn, err := connect(s, pw)
+		conn, err := config.connect(s, pw)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"system": s.Name,
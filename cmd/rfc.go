@@ -0,0 +1,38 @@
+// Copyright © 2020 Ulrich Anhalt <ulrich.anhalt@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import "github.com/pkg/errors"
+
+// the rfc connection is broken and has to be reopened
+var errCommunication = errors.New("rfc communication failure")
+
+// rfc connection to a sap application server
+type rfcClient interface {
+	Call(functionModule string, params map[string]interface{}) (map[string]interface{}, error)
+	Ping() error
+	Close() error
+}
+
+// open a rfc connection to the system with the given password
+type rfcConnector func(system SystemInfo, password string) (rfcClient, error)
+
+// establish connection to sap system with the configured connector
+func (config *Config) connect(system SystemInfo, password string) (rfcClient, error) {
+	if config.connector == nil {
+		return connect(system, password)
+	}
+	return config.connector(system, password)
+}
@@ -0,0 +1,91 @@
+//go:build gorfc
+// +build gorfc
+
+// Copyright © 2020 Ulrich Anhalt <ulrich.anhalt@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sap/gorfc/gorfc"
+	log "github.com/sirupsen/logrus"
+)
+
+// gorfc connection as rfc client
+type gorfcClient struct {
+	conn *gorfc.Connection
+}
+
+// Call - call function module
+func (c gorfcClient) Call(functionModule string, params map[string]interface{}) (map[string]interface{}, error) {
+	res, err := c.conn.Call(functionModule, params)
+	return res, communicationError(err)
+}
+
+// Ping - check connection
+func (c gorfcClient) Ping() error {
+	return communicationError(c.conn.Ping())
+}
+
+// Close - close connection
+func (c gorfcClient) Close() error {
+	return c.conn.Close()
+}
+
+// establish connection to sap system
+func connect(system SystemInfo, password string) (rfcClient, error) {
+	c, err := gorfc.ConnectionFromParams(
+		gorfc.ConnectionParameters{
+			"Dest":   system.Name,
+			"User":   system.User,
+			"Passwd": password,
+			"Client": system.Client,
+			"Lang":   system.Lang,
+			"Ashost": system.Server,
+			"Sysnr":  system.Sysnr,
+
+			"Mshost": system.Mshost,
+			"Msserv": system.Msserv,
+			"Group":  system.Group,
+
+			"Saprouter": system.Saprouter,
+			// "Trace":     "1",
+		},
+	)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"system": system.Name,
+			"server": system.Server,
+			"error":  err,
+		}).Warn("Can't connect to system with user/password")
+		return nil, err
+	}
+
+	return gorfcClient{c}, nil
+}
+
+// mark errors of broken connections as communication errors
+func communicationError(err error) error {
+	rfcErr, ok := err.(*gorfc.RfcError)
+	if !ok {
+		return err
+	}
+
+	switch rfcErr.ErrorInfo.Code {
+	case "RFC_COMMUNICATION_FAILURE", "RFC_INVALID_HANDLE", "RFC_CLOSED":
+		return errors.Wrap(errCommunication, rfcErr.Error())
+	}
+	return err
+}
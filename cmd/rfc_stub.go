@@ -0,0 +1,35 @@
+//go:build !gorfc
+// +build !gorfc
+
+// Copyright © 2020 Ulrich Anhalt <ulrich.anhalt@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// the exporter was built without the sap nwrfc sdk (build tag gorfc),
+// so no connection to a sap system is possible
+func connect(system SystemInfo, password string) (rfcClient, error) {
+	err := errors.New("connect(sapnwrfc_exporter was built without gorfc support - use go build -tags gorfc)")
+	log.WithFields(log.Fields{
+		"system": system.Name,
+		"server": system.Server,
+		"error":  err,
+	}).Warn("Can't connect to system with user/password")
+	return nil, err
+}
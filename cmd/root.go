@@ -17,11 +17,11 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/pkg/errors"
-	"github.com/sap/gorfc/gorfc"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -29,8 +29,8 @@ import (
 
 // server information
 type serverInfo struct {
-	name string
-	conn *gorfc.Connection
+	name   string
+	system SystemInfo
 }
 
 // SystemInfo - system information
@@ -49,6 +49,9 @@ type SystemInfo struct {
 	Group  string
 
 	Saprouter string
+
+	DiscoveryInterval uint
+	Labels            map[string]string
 }
 
 // standard metric info
@@ -57,9 +60,14 @@ type tomlMetric struct {
 	Help           string
 	MetricType     string
 	TagFilter      []string
+	Groups         []string
 	AllServers     bool
 	FunctionModule string
 	Params         map[string]interface{}
+	Interval       uint
+	Timeout        uint
+	Unit           string
+	ConstLabels    map[string]string
 	TableData      TableInfo
 	FieldData      FieldInfo
 	StructureData  StructureInfo
@@ -67,21 +75,53 @@ type tomlMetric struct {
 
 // TableInfo - specific table metric info
 type TableInfo struct {
-	Table     string
-	RowCount  map[string][]interface{}
-	RowFilter map[string][]interface{}
+	Table         string
+	RowCount      map[string][]interface{}
+	RowCountMatch map[string]string
+	FieldAsLabel  bool
+	RowFilter     map[string][]interface{}
+	Filters       []FilterInfo
+	Aggregate     string
+	ValueColumn   string
+	GroupBy       []string
+	RowLabels     []string
+	KeepCase      bool
+	ValueMap      valueMap
+	Scale         map[string]float64
+	Units         map[string]string
+	Buckets       []float64
+	Quantiles     []float64
+	MaxGroups     uint
+
+	rowCountRegexps map[rowCountKey]*regexp.Regexp
+	conv            valueConv
 }
 
 // FieldInfo - specific field metric info
 type FieldInfo struct {
 	FieldLabels []string
 	FieldValues []string
+	KeepCase    bool
+	ValueMap    valueMap
+	Scale       map[string]float64
+	Units       map[string]string
+	Derived     map[string]string
+
+	derived derivedValues
+	conv    valueConv
 }
 
 // StructureInfo - specific structure metric info
 type StructureInfo struct {
 	ExportStructure string
 	StructureFields []string
+	ValueMap        valueMap
+	Scale           map[string]float64
+	Units           map[string]string
+	Derived         map[string]string
+
+	derived derivedValues
+	conv    valueConv
 }
 
 type metricInfo struct {
@@ -89,27 +129,48 @@ type metricInfo struct {
 	Help           string
 	MetricType     string
 	TagFilter      []string
+	Groups         []string
 	AllServers     bool
 	FunctionModule string
 	Params         map[string]interface{}
+	Interval       uint
+	Timeout        uint
+	ConstLabels    map[string]string
 	special        dataReceiver
 }
 
 // interface for different handling of table- and field metrics
 type dataReceiver interface {
 	checkSpecialData() bool
+	dataLabels() []string
+	dataFields() []string
+	fieldUnits() map[string]string
 	metricData(rawData map[string]interface{}, system SystemInfo, srvName string) []metricRecord
 }
 
 // Config - information for the whole process
 type Config struct {
-	Secret     []byte
-	Systems    []SystemInfo // system info from toml file
-	Metrics    []tomlMetric // metric info from toml file
-	IntMetrics []metricInfo // adapted internal metrics
-	passwords  map[string]string
-	Timeout    uint
-	port       string
+	Secret       []byte
+	Systems      []SystemInfo // system info from toml file
+	SystemLabels []string     // system info fields recorded as labels
+	sysLabels    []string     // names of all system labels
+	Namespace    string       // optional prefix of all metric names
+	Metrics      []tomlMetric // metric info from toml file
+	IntMetrics   []metricInfo // adapted internal metrics
+	passwords    map[string]string
+	connector    rfcConnector
+	newTicker    tickerFunc
+	pool         *connPool
+	servers      *srvCache
+	snapshots    *snapshotStore
+	Timeout      uint
+	maxOpen      uint
+	maxIdle      uint
+	lifetime     uint
+	discovery    uint
+	interval     uint
+	background   bool
+	port         string
 }
 
 var cfgFile string
@@ -193,6 +254,18 @@ func (config *Config) checkConfig() error {
 	if err != nil {
 		return errors.Wrap(err, "getConfig(checkTomlSystems)")
 	}
+
+	// check additional labels of the systems
+	err = config.checkSystemLabels()
+	if err != nil {
+		return errors.Wrap(err, "getConfig(checkSystemLabels)")
+	}
+
+	// check label names of all metrics
+	err = config.checkMetricLabels()
+	if err != nil {
+		return errors.Wrap(err, "getConfig(checkMetricLabels)")
+	}
 	return nil
 }
 
@@ -205,9 +278,25 @@ func (config *Config) fillInternalMetrics() error {
 		}
 		config.IntMetrics = append(config.IntMetrics, mi)
 	}
+
+	if err := config.addNamespace(); err != nil {
+		return errors.Wrap(err, "getConfig(addNamespace)")
+	}
+	if err := config.checkMetricNames(); err != nil {
+		return errors.Wrap(err, "getConfig(checkMetricNames)")
+	}
 	return nil
 }
 
+// possible metric types
+var metricTypes = map[string]bool{
+	"counter":   true,
+	"gauge":     true,
+	"histogram": true,
+	"summary":   true,
+	"info":      true,
+}
+
 // check toml file metric entry and if ok return internal metric entry
 func checkTomlMetric(tm tomlMetric) (metricInfo, error) {
 
@@ -221,11 +310,11 @@ func checkTomlMetric(tm tomlMetric) (metricInfo, error) {
 		}).Error("missing mandatory metric field(s)")
 		return metricInfo{}, errors.New("checkTomlMetric(mandatory fields)")
 	}
-	if !strings.EqualFold(tm.MetricType, "counter") && !strings.EqualFold(tm.MetricType, "gauge") {
+	if !metricTypes[low(tm.MetricType)] {
 		log.WithFields(log.Fields{
 			"name":        tm.Name,
 			"metric type": tm.MetricType,
-		}).Error("MetricType must be counter or gauge")
+		}).Error("MetricType must be counter, gauge, histogram, summary or info")
 		return metricInfo{}, errors.New("checkTomlMetric(wrong metric type)")
 	}
 
@@ -235,6 +324,12 @@ func checkTomlMetric(tm tomlMetric) (metricInfo, error) {
 		tfLow = append(tfLow, low(tf))
 	}
 
+	// adapt groups
+	var groupsLow []string
+	for _, g := range tm.Groups {
+		groupsLow = append(groupsLow, low(g))
+	}
+
 	var data []dataReceiver
 	for _, d := range []dataReceiver{&tm.FieldData, &tm.TableData, &tm.StructureData} {
 		if d.checkSpecialData() {
@@ -249,14 +344,64 @@ func checkTomlMetric(tm tomlMetric) (metricInfo, error) {
 		return metricInfo{}, errors.New("checkTomlMetric(" + tm.Name + " more than one special info - field,structure or table)")
 	}
 
+	// info metrics record field labels with the value 1
+	name := low(tm.Name)
+	if "info" == low(tm.MetricType) {
+		if 0 == len(tm.FieldData.FieldLabels) {
+			log.WithFields(log.Fields{
+				"name":        tm.Name,
+				"metric type": tm.MetricType,
+			}).Error("MetricType info needs FieldData.FieldLabels")
+			return metricInfo{}, errors.New("checkTomlMetric(" + tm.Name + " info metric without field labels)")
+		}
+		if !strings.HasSuffix(name, "_info") {
+			name += "_info"
+		}
+	}
+
+	// the metric name must fit to the unit of the values
+	if err := checkUnit(name, low(tm.MetricType), tm.Unit, data[0].fieldUnits()); err != nil {
+		log.WithFields(log.Fields{
+			"name":  tm.Name,
+			"unit":  tm.Unit,
+			"error": err,
+		}).Error("Wrong metric unit")
+		return metricInfo{}, errors.Wrap(err, "checkTomlMetric("+tm.Name+")")
+	}
+
+	// histograms and summaries need the buckets or quantiles of a table column
+	mType := low(tm.MetricType)
+	if ("histogram" == mType) != (len(tm.TableData.Buckets) > 0) || ("summary" == mType) != (len(tm.TableData.Quantiles) > 0) {
+		log.WithFields(log.Fields{
+			"name":        tm.Name,
+			"metric type": tm.MetricType,
+		}).Error("MetricType histogram needs TableData.Buckets and summary needs TableData.Quantiles")
+		return metricInfo{}, errors.New("checkTomlMetric(" + tm.Name + " wrong histogram or summary info)")
+	}
+
+	constLabels, err := checkLabelNames(tm.ConstLabels)
+	if err != nil {
+		return metricInfo{}, errors.Wrap(err, "checkTomlMetric("+tm.Name+" const labels)")
+	}
+
+	// all param keys must be uppercase otherwise the function call returns an error
+	params := make(map[string]interface{})
+	for k, v := range tm.Params {
+		params[up(k)] = v
+	}
+
 	return metricInfo{
-		Name:           low(tm.Name),
+		Name:           name,
 		Help:           low(tm.Help),
 		MetricType:     low(tm.MetricType),
 		TagFilter:      tfLow,
+		Groups:         groupsLow,
 		AllServers:     tm.AllServers,
 		FunctionModule: up(tm.FunctionModule),
-		Params:         tm.Params,
+		Params:         params,
+		Interval:       tm.Interval,
+		Timeout:        tm.Timeout,
+		ConstLabels:    constLabels,
 		special:        data[0],
 	}, nil
 
@@ -264,43 +409,63 @@ func checkTomlMetric(tm tomlMetric) (metricInfo, error) {
 
 // check toml metric field data
 func (fi *FieldInfo) checkSpecialData() bool {
-	if 0 == len(fi.FieldValues) && 0 == len(fi.FieldLabels) {
+	if 0 == len(fi.FieldValues) && 0 == len(fi.FieldLabels) && 0 == len(fi.Derived) {
 		return false
 	}
 
-	if len(fi.FieldValues) > 0 && len(fi.FieldLabels) > 0 {
+	if len(fi.FieldLabels) > 0 && (len(fi.FieldValues) > 0 || len(fi.Derived) > 0) {
 		log.WithFields(log.Fields{
 			"field values": fi.FieldValues,
 			"field labels": fi.FieldLabels,
-		}).Error("Fieldinfo: only one entry FieldLabels or FieldValues is allowed")
+			"derived":      fi.Derived,
+		}).Error("Fieldinfo: only one entry FieldLabels or FieldValues/Derived is allowed")
 		return false
 	}
 
-	if len(fi.FieldLabels) > 0 || len(fi.FieldValues) > 0 {
-		for i := range fi.FieldLabels {
-			fi.FieldLabels[i] = low(fi.FieldLabels[i])
-		}
-		for i := range fi.FieldValues {
-			fi.FieldValues[i] = low(fi.FieldValues[i])
+	for i := range fi.FieldLabels {
+		fi.FieldLabels[i] = low(fi.FieldLabels[i])
+		if strings.Contains(fi.FieldLabels[i], "[]") {
+			log.WithFields(log.Fields{
+				"field label": fi.FieldLabels[i],
+			}).Error("Fieldinfo: FieldLabels need a single value - use [n] instead of []")
+			return false
 		}
-		return true
 	}
-	return false
+	for i := range fi.FieldValues {
+		fi.FieldValues[i] = low(fi.FieldValues[i])
+	}
+
+	var ok bool
+	if fi.derived, ok = parseDerived(fi.Derived); !ok {
+		return false
+	}
+	if fi.conv, ok = newValueConv(fi.ValueMap, fi.Scale, fi.Units, append(fi.derived.fields(), fi.FieldValues...)); !ok {
+		return false
+	}
+	return checkPaths(append(fi.FieldLabels, fi.FieldValues...))
 }
 
 // check toml metric structure data
 func (si *StructureInfo) checkSpecialData() bool {
 
-	if 0 == len(si.ExportStructure) && 0 == len(si.StructureFields) {
+	if 0 == len(si.ExportStructure) && 0 == len(si.StructureFields) && 0 == len(si.Derived) {
 		return false
 	}
 
-	if len(si.ExportStructure) > 0 && len(si.StructureFields) > 0 {
+	if len(si.ExportStructure) > 0 && (len(si.StructureFields) > 0 || len(si.Derived) > 0) {
 		si.ExportStructure = up(si.ExportStructure)
 		for i := range si.StructureFields {
 			si.StructureFields[i] = low(si.StructureFields[i])
 		}
-		return true
+
+		var ok bool
+		if si.derived, ok = parseDerived(si.Derived); !ok {
+			return false
+		}
+		if si.conv, ok = newValueConv(si.ValueMap, si.Scale, si.Units, append(si.derived.fields(), si.StructureFields...)); !ok {
+			return false
+		}
+		return checkPaths(append([]string{si.ExportStructure}, si.StructureFields...))
 	}
 
 	log.WithFields(log.Fields{
@@ -312,20 +477,132 @@ func (si *StructureInfo) checkSpecialData() bool {
 
 // check toml metric table data
 func (ti *TableInfo) checkSpecialData() bool {
-	if 0 == len(ti.Table) && 0 == len(ti.RowCount) && 0 == len(ti.RowFilter) {
+	if 0 == len(ti.Table) && 0 == len(ti.RowCount) && 0 == len(ti.RowFilter) && 0 == len(ti.Filters) && 0 == len(ti.Aggregate) && 0 == len(ti.RowLabels) && 0 == len(ti.Buckets) && 0 == len(ti.Quantiles) {
 		return false
 	}
 
-	if len(ti.Table) > 0 && len(ti.RowCount) > 0 {
-		ti.Table = up(ti.Table)
-		return true
+	modes := 0
+	for _, used := range []bool{len(ti.RowCount) > 0, len(ti.Aggregate) > 0, len(ti.RowLabels) > 0, len(ti.Buckets) > 0 || len(ti.Quantiles) > 0} {
+		if used {
+			modes++
+		}
 	}
 
-	log.WithFields(log.Fields{
-		"Table":    ti.Table,
-		"RowCount": ti.RowCount,
-	}).Error("TableInfo: one or both entries missing")
-	return false
+	if 0 == len(ti.Table) || 0 == modes {
+		log.WithFields(log.Fields{
+			"Table":     ti.Table,
+			"RowCount":  ti.RowCount,
+			"Aggregate": ti.Aggregate,
+			"RowLabels": ti.RowLabels,
+		}).Error("TableInfo: one or both entries missing")
+		return false
+	}
+	ti.Table = up(ti.Table)
+	if !checkPaths([]string{ti.Table}) {
+		return false
+	}
+
+	for i := range ti.Filters {
+		if !ti.Filters[i].check() {
+			return false
+		}
+	}
+
+	if modes > 1 {
+		log.WithFields(log.Fields{
+			"RowCount":  ti.RowCount,
+			"Aggregate": ti.Aggregate,
+			"RowLabels": ti.RowLabels,
+			"Buckets":   ti.Buckets,
+			"Quantiles": ti.Quantiles,
+		}).Error("TableInfo: only one entry RowCount, Aggregate, RowLabels, Buckets or Quantiles is allowed")
+		return false
+	}
+
+	if ti.FieldAsLabel && 0 == len(ti.RowCount) {
+		log.WithFields(log.Fields{
+			"Table": ti.Table,
+		}).Error("TableInfo: FieldAsLabel needs RowCount")
+		return false
+	}
+
+	// row counts are not converted
+	if len(ti.RowCount) > 0 {
+		if len(ti.ValueMap) > 0 || len(ti.Scale) > 0 || len(ti.Units) > 0 {
+			log.WithFields(log.Fields{
+				"ValueMap": ti.ValueMap,
+				"Scale":    ti.Scale,
+				"Units":    ti.Units,
+			}).Error("TableInfo: ValueMap, Scale and Units are not allowed with RowCount")
+			return false
+		}
+		return ti.checkRowCountMatch()
+	}
+
+	if len(ti.RowLabels) > 0 {
+		if 0 == len(ti.ValueColumn) {
+			log.WithFields(log.Fields{
+				"RowLabels": ti.RowLabels,
+			}).Error("TableInfo: RowLabels needs a ValueColumn")
+			return false
+		}
+	} else if len(ti.Buckets) > 0 || len(ti.Quantiles) > 0 {
+		if !ti.checkDistribution() {
+			return false
+		}
+	} else {
+		ti.Aggregate = low(ti.Aggregate)
+		if _, ok := aggregators[ti.Aggregate]; !ok {
+			log.WithFields(log.Fields{
+				"Aggregate": ti.Aggregate,
+			}).Error("TableInfo: Aggregate must be count, sum, avg, min or max")
+			return false
+		}
+
+		if "count" == ti.Aggregate {
+			if 0 == len(ti.GroupBy) {
+				log.WithFields(log.Fields{
+					"Aggregate": ti.Aggregate,
+				}).Error("TableInfo: Aggregate count needs GroupBy columns")
+				return false
+			}
+		} else if 0 == len(ti.ValueColumn) {
+			log.WithFields(log.Fields{
+				"Aggregate": ti.Aggregate,
+			}).Error("TableInfo: Aggregate needs a ValueColumn")
+			return false
+		}
+	}
+
+	if 0 == ti.MaxGroups {
+		ti.MaxGroups = defaultMaxGroups
+	}
+
+	ti.ValueColumn = low(ti.ValueColumn)
+	var ok bool
+	if ti.conv, ok = newValueConv(ti.ValueMap, ti.Scale, ti.Units, []string{ti.ValueColumn}); !ok {
+		return false
+	}
+	for i := range ti.GroupBy {
+		ti.GroupBy[i] = low(ti.GroupBy[i])
+	}
+	for i := range ti.RowLabels {
+		ti.RowLabels[i] = low(ti.RowLabels[i])
+	}
+	return true
+}
+
+// check the syntax of field and structure paths
+func checkPaths(paths []string) bool {
+	for _, path := range paths {
+		if !validPath(path) {
+			log.WithFields(log.Fields{
+				"path": path,
+			}).Error("wrong path - e.g. \"INFO.MEMORY.USED\" or \"ET_RESULT[].VALUE\" is expected")
+			return false
+		}
+	}
+	return true
 }
 
 // check toml metric systems data
@@ -353,38 +630,6 @@ func (config *Config) checkTomlSystems() error {
 	return nil
 }
 
-// establish connection to sap system
-func connect(system SystemInfo, password string) (*gorfc.Connection, error) {
-	c, err := gorfc.ConnectionFromParams(
-		gorfc.ConnectionParameters{
-			"Dest":   system.Name,
-			"User":   system.User,
-			"Passwd": password,
-			"Client": system.Client,
-			"Lang":   system.Lang,
-			"Ashost": system.Server,
-			"Sysnr":  system.Sysnr,
-
-			"Mshost": system.Mshost,
-			"Msserv": system.Msserv,
-			"Group":  system.Group,
-
-			"Saprouter": system.Saprouter,
-			// "Trace":     "1",
-		},
-	)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"system": system.Name,
-			"server": system.Server,
-			"error":  err,
-		}).Warn("Can't connect to system with user/password")
-		return nil, err
-	}
-
-	return c, nil
-}
-
 // convert interface int values to string
 func interface2String(namePart interface{}) string {
 
@@ -421,6 +666,7 @@ func low(str string) string {
 	return strings.TrimSpace(strings.ToLower(str))
 }
 
+// true if any field of the row has one of the filter values
 func inFilter(line map[string]interface{}, filter map[string][]interface{}) bool {
 	for field, values := range filter {
 		for _, value := range values {
@@ -0,0 +1,224 @@
+// Copyright © 2020 Ulrich Anhalt <ulrich.anhalt@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// number of collection intervals a system snapshot is kept without answer
+const snapshotMaxIntervals = 5
+
+var (
+	collectionTimestampDesc = prometheus.NewDesc(
+		"sapnwrfc_metric_collection_timestamp_seconds",
+		"Time of the last successful collection of a metric for a system.",
+		[]string{"metric", "system"}, nil,
+	)
+	collectionAgeDesc = prometheus.NewDesc(
+		"sapnwrfc_metric_age_seconds",
+		"Age of the served metric data of a system.",
+		[]string{"metric", "system"}, nil,
+	)
+)
+
+// last collected records of all metrics
+type snapshotStore struct {
+	mu         sync.Mutex
+	metrics    map[string]*metricSnapshot
+	collecting map[string]*sync.Mutex
+}
+
+// last collected records of one metric per system
+type metricSnapshot struct {
+	name       string
+	help       string
+	metricType string
+	collected  time.Time
+	systems    map[string]systemSnapshot
+}
+
+// last collected records of one metric and system
+type systemSnapshot struct {
+	records   []metricRecord
+	collected time.Time
+}
+
+// create empty snapshot store
+func newSnapshotStore() *snapshotStore {
+	return &snapshotStore{
+		metrics:    make(map[string]*metricSnapshot),
+		collecting: make(map[string]*sync.Mutex),
+	}
+}
+
+// store the records of the systems, that answered
+// records of the other systems are kept until they are older than maxAge
+func (ss *snapshotStore) store(mi metricInfo, sysRecords map[string][]metricRecord, maxAge time.Duration) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ms, ok := ss.metrics[mi.Name]
+	if !ok {
+		ms = &metricSnapshot{
+			name:       mi.Name,
+			help:       mi.Help,
+			metricType: mi.MetricType,
+			systems:    make(map[string]systemSnapshot),
+		}
+		ss.metrics[mi.Name] = ms
+	}
+
+	// the metric counts as collected only if at least one system answered
+	now := time.Now()
+	if len(sysRecords) > 0 {
+		ms.collected = now
+	}
+	for system, records := range sysRecords {
+		ms.systems[system] = systemSnapshot{records, now}
+	}
+	for system, snap := range ms.systems {
+		if now.Sub(snap.collected) > maxAge {
+			delete(ms.systems, system)
+		}
+	}
+}
+
+// serialize the collections of a metric, returns the unlock function
+func (ss *snapshotStore) lockMetric(name string) func() {
+	ss.mu.Lock()
+	m, ok := ss.collecting[name]
+	if !ok {
+		m = &sync.Mutex{}
+		ss.collecting[name] = m
+	}
+	ss.mu.Unlock()
+
+	m.Lock()
+	return m.Unlock
+}
+
+// metric data of the last collections of the given metrics
+func (ss *snapshotStore) metricData(metrics []metricInfo) []metricData {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	var mData []metricData
+	for _, mi := range metrics {
+		if ms, ok := ss.metrics[mi.Name]; ok {
+			mData = append(mData, ms.metricData())
+		}
+	}
+	return mData
+}
+
+// metric data of the last collection of a metric, false if the collection
+// is older than maxAge
+func (ss *snapshotStore) recent(name string, maxAge time.Duration) (metricData, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ms, ok := ss.metrics[name]
+	if !ok || time.Since(ms.collected) >= maxAge {
+		return metricData{}, false
+	}
+	return ms.metricData(), true
+}
+
+// metric data of all systems
+func (ms *metricSnapshot) metricData() metricData {
+	md := metricData{
+		name:       ms.name,
+		help:       ms.help,
+		metricType: ms.metricType,
+	}
+	for _, snap := range ms.systems {
+		md.stats = append(md.stats, snap.records...)
+	}
+	return md
+}
+
+// Describe implements prometheus.Collector.
+func (ss *snapshotStore) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collectionTimestampDesc
+	ch <- collectionAgeDesc
+}
+
+// Collect implements prometheus.Collector.
+func (ss *snapshotStore) Collect(ch chan<- prometheus.Metric) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for _, ms := range ss.metrics {
+		for system, snap := range ms.systems {
+			ch <- prometheus.MustNewConstMetric(collectionTimestampDesc, prometheus.GaugeValue, float64(snap.collected.Unix()), ms.name, system)
+			ch <- prometheus.MustNewConstMetric(collectionAgeDesc, prometheus.GaugeValue, time.Since(snap.collected).Seconds(), ms.name, system)
+		}
+	}
+}
+
+// collection interval of a metric
+func (config *Config) metricInterval(mPos int) time.Duration {
+	if config.IntMetrics[mPos].Interval > 0 {
+		return time.Duration(config.IntMetrics[mPos].Interval) * time.Second
+	}
+	return time.Duration(config.interval) * time.Second
+}
+
+// age after which the snapshot of a system, that did not answer anymore, is dropped
+func (config *Config) snapshotMaxAge(mPos int) time.Duration {
+	return snapshotMaxIntervals * config.metricInterval(mPos)
+}
+
+// collection timeout of a metric
+func (config *Config) metricTimeout(mPos int) time.Duration {
+	if config.IntMetrics[mPos].Timeout > 0 {
+		return time.Duration(config.IntMetrics[mPos].Timeout) * time.Second
+	}
+	return time.Duration(config.Timeout) * time.Second
+}
+
+// longest collection timeout of all metrics
+func (config *Config) maxTimeout() time.Duration {
+	max := time.Duration(config.Timeout) * time.Second
+	for mPos := range config.IntMetrics {
+		if config.metricTimeout(mPos) > max {
+			max = config.metricTimeout(mPos)
+		}
+	}
+	return max
+}
+
+// collect all metrics in the background, every metric in its own interval
+func (config *Config) startScheduler(stop <-chan struct{}) {
+	for mPos := range config.IntMetrics {
+		go func(mPos int) {
+			tick, stopTicker := config.ticker(config.metricInterval(mPos))
+			defer stopTicker()
+
+			for {
+				config.snapshots.store(config.IntMetrics[mPos], config.collectSystemsMetric(mPos), config.snapshotMaxAge(mPos))
+				select {
+				case <-tick:
+				case <-stop:
+					return
+				}
+			}
+		}(mPos)
+	}
+}
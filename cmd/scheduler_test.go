@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SchedulerSnapshots(t *testing.T) {
+	assert := assert.New(t)
+
+	config, fb := getFakeConfig(t, tomlMetric{
+		Name:           "sap_tune_storage_infos",
+		Help:           "storage",
+		MetricType:     "gauge",
+		FunctionModule: "SAPTUNE_GET_STORAGE_INFOS",
+		FieldData: FieldInfo{
+			FieldValues: []string{"page_bufsz"},
+		},
+	})
+	config.interval = 1
+	config.snapshots = newSnapshotStore()
+	ft := newFakeTicker()
+	config.newTicker = ft.ticker
+
+	stop := make(chan struct{})
+	defer close(stop)
+	config.startScheduler(stop)
+	assert.Eventually(func() bool { return len(snapshotTimes(config.snapshots, "sap_tune_storage_infos")) == 2 }, time.Second, time.Millisecond)
+	first := snapshotTimes(config.snapshots, "sap_tune_storage_infos")
+
+	// the second collection of one system fails, its first result is kept
+	fb.fail("SAPTUNE_GET_STORAGE_INFOS", errors.New("not available"))
+	ft.channel(time.Second) <- time.Now()
+	assert.Eventually(func() bool {
+		second := snapshotTimes(config.snapshots, "sap_tune_storage_infos")
+		return second["t01"] != first["t01"] || second["t02"] != first["t02"]
+	}, time.Second, time.Millisecond)
+	assert.Equal(4, fb.callCount("SAPTUNE_GET_STORAGE_INFOS"))
+
+	data := config.snapshots.metricData(config.IntMetrics)
+	assert.Equal(1, len(data))
+	assert.Equal(2, len(data[0].stats))
+	r, ok := findRecord(data[0].stats, "t01", "page_bufsz")
+	assert.True(ok)
+	assert.Equal(1024.0, r.value)
+	r, ok = findRecord(data[0].stats, "t02", "page_bufsz")
+	assert.True(ok)
+	assert.Equal(2048.0, r.value)
+
+	// timestamp and age per metric and system, only one system was collected again
+	assert.Equal(2, testutil.CollectAndCount(config.snapshots, "sapnwrfc_metric_collection_timestamp_seconds"))
+	assert.Equal(2, testutil.CollectAndCount(config.snapshots, "sapnwrfc_metric_age_seconds"))
+	second := snapshotTimes(config.snapshots, "sap_tune_storage_infos")
+	assert.True((second["t01"] == first["t01"]) != (second["t02"] == first["t02"]))
+}
+
+// collection times of the system snapshots of the metric
+func snapshotTimes(ss *snapshotStore, name string) map[string]time.Time {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	times := make(map[string]time.Time)
+	if ms, ok := ss.metrics[name]; ok {
+		for system, snap := range ms.systems {
+			times[system] = snap.collected
+		}
+	}
+	return times
+}
+
+func Test_SnapshotStore(t *testing.T) {
+	assert := assert.New(t)
+
+	mi := metricInfo{Name: "sap_tune_storage_infos", Help: "storage", MetricType: "gauge"}
+	ss := newSnapshotStore()
+	ss.store(mi, map[string][]metricRecord{
+		"t01": {{labels: []string{"system"}, labelValues: []string{"t01"}, value: 1}},
+		"t02": {{labels: []string{"system"}, labelValues: []string{"t02"}, value: 2}},
+	}, time.Minute)
+	assert.Equal(2, len(ss.metricData([]metricInfo{mi})[0].stats))
+
+	// t01 answers without records, t02 does not answer
+	ss.store(mi, map[string][]metricRecord{"t01": {}}, time.Minute)
+	data := ss.metricData([]metricInfo{mi})[0]
+	assert.Equal(1, len(data.stats))
+	assert.Equal("t02", data.stats[0].labelValues[0])
+
+	// the t02 snapshot is dropped after maxAge
+	ms := ss.metrics[mi.Name]
+	ms.systems["t02"] = systemSnapshot{ms.systems["t02"].records, time.Now().Add(-2 * time.Minute)}
+	ss.store(mi, map[string][]metricRecord{"t01": {}}, time.Minute)
+	assert.Equal(0, len(ss.metricData([]metricInfo{mi})[0].stats))
+	assert.Equal(1, len(ms.systems))
+}
+
+func Test_MetricIntervalTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	config, fb := getFakeConfig(t, tomlMetric{
+		Name:           "sap_tune_storage_infos",
+		Help:           "storage",
+		MetricType:     "gauge",
+		FunctionModule: "SAPTUNE_GET_STORAGE_INFOS",
+		Interval:       3600,
+		Timeout:        30,
+		FieldData: FieldInfo{
+			FieldValues: []string{"page_bufsz"},
+		},
+	}, tomlMetric{
+		Name:           "sap_stapi_version",
+		Help:           "st-a/pi",
+		MetricType:     "gauge",
+		FunctionModule: "ANST_OCS_GET_COMPONENT_STATE",
+		FieldData: FieldInfo{
+			FieldLabels: []string{"ev_comp_rel"},
+		},
+	})
+	config.interval = 60
+	config.snapshots = newSnapshotStore()
+
+	assert.Equal(time.Hour, config.metricInterval(0))
+	assert.Equal(time.Minute, config.metricInterval(1))
+	assert.Equal(30*time.Second, config.metricTimeout(0))
+	assert.Equal(3*time.Second, config.metricTimeout(1))
+	assert.Equal(30*time.Second, config.maxTimeout())
+
+	// metric with interval is collected once, the other one on every scrape
+	for i := 0; i < 3; i++ {
+		data := config.collectMetrics()
+		assert.Equal(2, len(data))
+		for _, md := range data {
+			if md.name == "sap_tune_storage_infos" {
+				assert.Equal(2, len(md.stats))
+			}
+		}
+	}
+	assert.Equal(2, fb.callCount("SAPTUNE_GET_STORAGE_INFOS"))
+	assert.Equal(6, fb.callCount("ANST_OCS_GET_COMPONENT_STATE"))
+}
+
+func Test_MetricIntervalCollected(t *testing.T) {
+	assert := assert.New(t)
+
+	config, fb := getFakeConfig(t, tomlMetric{
+		Name:           "sap_tune_storage_infos",
+		Help:           "storage",
+		MetricType:     "gauge",
+		FunctionModule: "SAPTUNE_GET_STORAGE_INFOS",
+		Interval:       3600,
+		FieldData: FieldInfo{
+			FieldValues: []string{"page_bufsz"},
+		},
+	})
+	config.snapshots = newSnapshotStore()
+
+	// without answer of any system the metric is not collected
+	config.snapshots.store(config.IntMetrics[0], map[string][]metricRecord{}, time.Hour)
+	_, ok := config.snapshots.recent("sap_tune_storage_infos", time.Hour)
+	assert.False(ok)
+
+	// concurrent scrapes share one collection
+	fb.delay("t01", 200*time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data := config.collectMetrics()
+			assert.Equal(1, len(data))
+			assert.Equal(2, len(data[0].stats))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(2, fb.callCount("SAPTUNE_GET_STORAGE_INFOS"))
+	_, ok = config.snapshots.recent("sap_tune_storage_infos", time.Hour)
+	assert.True(ok)
+}
@@ -0,0 +1,231 @@
+// Copyright © 2020 Ulrich Anhalt <ulrich.anhalt@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	discoveredServerDesc = prometheus.NewDesc(
+		"sapnwrfc_discovered_server",
+		"Application servers found by the last successful server discovery.",
+		[]string{"system", "server", "sysnr"}, nil,
+	)
+	discoveryTimestampDesc = prometheus.NewDesc(
+		"sapnwrfc_server_discovery_timestamp_seconds",
+		"Time of the last successful application server discovery.",
+		[]string{"system"}, nil,
+	)
+)
+
+// cached application servers of the systems
+type srvCache struct {
+	mu    sync.Mutex
+	lists map[string]*srvList
+}
+
+// application servers of one system
+type srvList struct {
+	discovering sync.Mutex
+	servers     []serverInfo
+	discovered  time.Time
+}
+
+// create empty server cache
+func newSrvCache() *srvCache {
+	return &srvCache{
+		lists: make(map[string]*srvList),
+	}
+}
+
+// server list of a system
+func (sc *srvCache) list(system string) *srvList {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if _, ok := sc.lists[system]; !ok {
+		sc.lists[system] = &srvList{}
+	}
+	return sc.lists[system]
+}
+
+// cached servers of a system, false if no discovery was successful so far
+func (sc *srvCache) get(system string) ([]serverInfo, bool) {
+	sl := sc.list(system)
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sl.servers, !sl.discovered.IsZero()
+}
+
+// store result of a successful discovery
+func (sc *srvCache) set(system string, servers []serverInfo) {
+	sl := sc.list(system)
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sl.servers = servers
+	sl.discovered = time.Now()
+}
+
+// Describe implements prometheus.Collector.
+func (sc *srvCache) Describe(ch chan<- *prometheus.Desc) {
+	ch <- discoveredServerDesc
+	ch <- discoveryTimestampDesc
+}
+
+// Collect implements prometheus.Collector.
+func (sc *srvCache) Collect(ch chan<- prometheus.Metric) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for system, sl := range sc.lists {
+		if sl.discovered.IsZero() {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(discoveryTimestampDesc, prometheus.GaugeValue, float64(sl.discovered.Unix()), system)
+		for _, srv := range sl.servers {
+			ch <- prometheus.MustNewConstMetric(discoveredServerDesc, prometheus.GaugeValue, 1, system, srv.name, srv.system.Sysnr)
+		}
+	}
+}
+
+// ticker of the background loops, returns the tick channel and the stop function
+type tickerFunc func(d time.Duration) (<-chan time.Time, func())
+
+// ticker with the configured ticker function or a time.Ticker
+func (config *Config) ticker(d time.Duration) (<-chan time.Time, func()) {
+	if config.newTicker != nil {
+		return config.newTicker(d)
+	}
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
+
+// discover the application servers of all systems in the background
+func (config *Config) startDiscovery(stop <-chan struct{}) {
+	for sPos := range config.Systems {
+		interval := config.Systems[sPos].DiscoveryInterval
+		if interval == 0 {
+			interval = config.discovery
+		}
+		if interval == 0 {
+			continue
+		}
+
+		go func(sPos int, interval time.Duration) {
+			tick, stopTicker := config.ticker(interval)
+			defer stopTicker()
+
+			for {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Timeout)*time.Second)
+				config.discoverServers(ctx, sPos, false)
+				cancel()
+
+				select {
+				case <-tick:
+				case <-stop:
+					return
+				}
+			}
+		}(sPos, time.Duration(interval)*time.Second)
+	}
+}
+
+// retrieve system servers with function module TH_SERVER_LIST
+// with onlyMissing the discovery is skipped, if it was already successful
+func (config *Config) discoverServers(ctx context.Context, sPos int, onlyMissing bool) error {
+	system := config.Systems[sPos]
+
+	sl := config.servers.list(system.Name)
+	sl.discovering.Lock()
+	defer sl.discovering.Unlock()
+
+	if _, ok := config.servers.get(system.Name); ok && onlyMissing {
+		return nil
+	}
+
+	params := map[string]interface{}{}
+	r, err := config.pool.call(ctx, system, config.passwords[system.Name], "TH_SERVER_LIST", params)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"system": system.Name,
+			"error":  err,
+		}).Error("Can't call fumo th_server_list")
+		return errors.Wrap(err, "discoverServers(TH_SERVER_LIST)")
+	}
+
+	// Issue 5 why is r["LIST"] == nil ?????
+	if r["LIST"] == nil {
+		config.servers.set(system.Name, nil)
+		return nil
+	}
+
+	var servers []serverInfo
+	for _, v := range r["LIST"].([]interface{}) {
+		appl := v.(map[string]interface{})
+		if _, ok := appl["NAME"]; !ok {
+			continue
+		}
+		info := strings.Split(strings.TrimSpace(appl["NAME"].(string)), "_")
+		if len(info) < 3 {
+			log.WithFields(log.Fields{
+				"system": system.Name,
+				"name":   appl["NAME"],
+			}).Warn("Unexpected application server name")
+			continue
+		}
+
+		sys := system
+		sys.Server = strings.TrimSpace(info[0])
+		sys.Sysnr = strings.TrimSpace(info[2])
+
+		servers = append(servers, serverInfo{info[0], sys})
+	}
+
+	config.servers.set(system.Name, servers)
+	return nil
+}
+
+// servers of the system, that are relevant for the metric
+func (config *Config) getSrvInfo(ctx context.Context, mPos, sPos int) []serverInfo {
+	system := config.Systems[sPos]
+	standard := []serverInfo{{system.Name, system}}
+
+	// only one server is needed for the metric -> standard system connection
+	if !config.IntMetrics[mPos].AllServers {
+		return standard
+	}
+
+	// no successful discovery so far
+	if err := config.discoverServers(ctx, sPos, true); err != nil {
+		return nil
+	}
+	servers, _ := config.servers.get(system.Name)
+
+	// all servers are needed but only one server exists
+	if len(servers) <= 1 {
+		return standard
+	}
+	return servers
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ServerDiscoveryCache(t *testing.T) {
+	assert := assert.New(t)
+
+	config, fb := getFakeConfig(t, tomlMetric{
+		Name:           "sap_tune_storage_infos",
+		Help:           "storage",
+		MetricType:     "gauge",
+		FunctionModule: "SAPTUNE_GET_STORAGE_INFOS",
+		AllServers:     true,
+		FieldData: FieldInfo{
+			FieldValues: []string{"page_bufsz"},
+		},
+	}, tomlMetric{
+		Name:           "sap_processes",
+		Help:           "sm50",
+		MetricType:     "gauge",
+		FunctionModule: "TH_WPINFO",
+		AllServers:     true,
+		TableData: TableInfo{
+			Table:    "WPLIST",
+			RowCount: map[string][]interface{}{"wp_typ": {"dia"}},
+		},
+	})
+
+	for i := 0; i < 3; i++ {
+		config.collectMetrics()
+	}
+
+	// one discovery per system for all metrics and scrapes
+	assert.Equal(2, fb.callCount("TH_SERVER_LIST"))
+	servers, ok := config.servers.get("t02")
+	assert.True(ok)
+	assert.Equal(2, len(servers))
+	assert.Equal("host3", servers[1].system.Server)
+	assert.Equal("00", servers[1].system.Sysnr)
+
+	// metrics for the discovered servers
+	assert.Equal(2, testutil.CollectAndCount(config.servers, "sapnwrfc_server_discovery_timestamp_seconds"))
+	expected := `
+		# HELP sapnwrfc_discovered_server Application servers found by the last successful server discovery.
+		# TYPE sapnwrfc_discovered_server gauge
+		sapnwrfc_discovered_server{server="host1",sysnr="01",system="t01"} 1
+		sapnwrfc_discovered_server{server="host2",sysnr="00",system="t02"} 1
+		sapnwrfc_discovered_server{server="host3",sysnr="00",system="t02"} 1
+	`
+	assert.Nil(testutil.CollectAndCompare(config.servers, strings.NewReader(expected), "sapnwrfc_discovered_server"))
+}
+
+func Test_ServerDiscoveryBackground(t *testing.T) {
+	assert := assert.New(t)
+
+	config, fb := getFakeConfig(t)
+	config.Systems[0].DiscoveryInterval = 1
+	config.discovery = 3600
+	ft := newFakeTicker()
+	config.newTicker = ft.ticker
+
+	stop := make(chan struct{})
+	defer close(stop)
+	config.startDiscovery(stop)
+
+	// initial discovery of t01 and t02
+	assert.Eventually(func() bool { return fb.callCount("TH_SERVER_LIST") == 2 }, time.Second, time.Millisecond)
+
+	// t01 ticks with its own 1s interval, t02 with the default interval
+	ft.channel(time.Second) <- time.Now()
+	assert.Eventually(func() bool { return fb.callCount("TH_SERVER_LIST") == 3 }, time.Second, time.Millisecond)
+	_, ok := config.servers.get("t02")
+	assert.True(ok)
+}
+
+// ticker channels per interval, ticked by the test
+type fakeTicker struct {
+	mu       sync.Mutex
+	channels map[time.Duration]chan time.Time
+}
+
+func newFakeTicker() *fakeTicker {
+	return &fakeTicker{channels: make(map[time.Duration]chan time.Time)}
+}
+
+func (ft *fakeTicker) ticker(d time.Duration) (<-chan time.Time, func()) {
+	return ft.channel(d), func() {}
+}
+
+func (ft *fakeTicker) channel(d time.Duration) chan time.Time {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	if _, ok := ft.channels[d]; !ok {
+		ft.channels[d] = make(chan time.Time)
+	}
+	return ft.channels[d]
+}
@@ -0,0 +1,432 @@
+// Copyright © 2020 Ulrich Anhalt <ulrich.anhalt@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// default cardinality cap of the groups of a table metric
+const defaultMaxGroups = 100
+
+// aggregation of the values of a group of table rows
+type aggregation struct {
+	count float64
+	sum   float64
+	min   float64
+	max   float64
+}
+
+// possible TableInfo.Aggregate functions
+var aggregators = map[string]func(a aggregation) float64{
+	"count": func(a aggregation) float64 { return a.count },
+	"sum":   func(a aggregation) float64 { return a.sum },
+	"avg":   func(a aggregation) float64 { return a.sum / a.count },
+	"min":   func(a aggregation) float64 { return a.min },
+	"max":   func(a aggregation) float64 { return a.max },
+}
+
+// add value to aggregation
+func (a *aggregation) add(val float64) {
+	if 0 == a.count || val < a.min {
+		a.min = val
+	}
+	if 0 == a.count || val > a.max {
+		a.max = val
+	}
+	a.count++
+	a.sum += val
+}
+
+// aggregate the value column of the table rows, one record per group
+func (tMetric TableInfo) aggregateData(rows []map[string]interface{}, system SystemInfo, srvName string) []metricRecord {
+
+	groups := make(map[string]*aggregation)
+	groupValues := make(map[string][]string)
+
+	for _, line := range rows {
+		f64Val := 1.0
+		if "count" != tMetric.Aggregate {
+			var err error
+			f64Val, err = tMetric.conv.number(tMetric.ValueColumn, line[up(tMetric.ValueColumn)])
+			if err != nil {
+				log.WithFields(log.Fields{
+					"system":      system.Name,
+					"server":      srvName,
+					"valueColumn": tMetric.ValueColumn,
+					"error":       err,
+				}).Debug("aggregateData: row value is not a number")
+				continue
+			}
+		}
+
+		values := tMetric.columnValues(line, tMetric.GroupBy)
+		key := strings.Join(values, "\x00")
+		if _, ok := groups[key]; !ok {
+			groups[key] = &aggregation{}
+			groupValues[key] = values
+		}
+		groups[key].add(f64Val)
+	}
+
+	// without groups a sum is always reported
+	if 0 == len(groups) && 0 == len(tMetric.GroupBy) && "sum" == tMetric.Aggregate {
+		groups[""] = &aggregation{}
+	}
+
+	var keys []string
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// protect prometheus against too many series
+	if tMetric.MaxGroups > 0 && uint(len(keys)) > tMetric.MaxGroups {
+		log.WithFields(log.Fields{
+			"system":    system.Name,
+			"server":    srvName,
+			"table":     tMetric.Table,
+			"groups":    len(keys),
+			"maxGroups": tMetric.MaxGroups,
+		}).Warn("aggregateData: too many groups - surplus groups are skipped")
+		keys = keys[:tMetric.MaxGroups]
+	}
+
+	labels := append([]string{"system", "usage", "server"}, labelNames(tMetric.GroupBy)...)
+
+	var md []metricRecord
+	for _, key := range keys {
+		md = append(md, metricRecord{
+			labels:      labels,
+			labelValues: append([]string{system.Name, system.Usage, srvName}, groupValues[key]...),
+			value:       aggregators[tMetric.Aggregate](*groups[key]),
+		})
+	}
+	return md
+}
+
+// one record per table row with the value column as value
+func (tMetric TableInfo) rowData(rows []map[string]interface{}, system SystemInfo, srvName string) []metricRecord {
+
+	labels := append([]string{"system", "usage", "server"}, labelNames(tMetric.RowLabels)...)
+	seen := make(map[string]bool)
+
+	var md []metricRecord
+	for _, line := range rows {
+		f64Val, err := tMetric.conv.number(tMetric.ValueColumn, line[up(tMetric.ValueColumn)])
+		if err != nil {
+			log.WithFields(log.Fields{
+				"system":      system.Name,
+				"server":      srvName,
+				"valueColumn": tMetric.ValueColumn,
+				"error":       err,
+			}).Debug("rowData: row value is not a number")
+			continue
+		}
+
+		// prometheus rejects series with equal label values
+		values := tMetric.columnValues(line, tMetric.RowLabels)
+		key := strings.Join(values, "\x00")
+		if seen[key] {
+			log.WithFields(log.Fields{
+				"system":    system.Name,
+				"server":    srvName,
+				"table":     tMetric.Table,
+				"rowLabels": values,
+			}).Warn("rowData: duplicate row labels - row is skipped")
+			continue
+		}
+		seen[key] = true
+
+		if tMetric.MaxGroups > 0 && uint(len(md)) >= tMetric.MaxGroups {
+			log.WithFields(log.Fields{
+				"system":    system.Name,
+				"server":    srvName,
+				"table":     tMetric.Table,
+				"maxGroups": tMetric.MaxGroups,
+			}).Warn("rowData: too many rows - surplus rows are skipped")
+			break
+		}
+
+		md = append(md, metricRecord{
+			labels:      labels,
+			labelValues: append([]string{system.Name, system.Usage, srvName}, values...),
+			value:       f64Val,
+		})
+	}
+	return md
+}
+
+// values of the given columns of a table row, lowercased without KeepCase
+func (tMetric TableInfo) columnValues(line map[string]interface{}, columns []string) []string {
+	values := make([]string, 0, len(columns))
+	for _, column := range columns {
+		value := formatValue(line[up(column)])
+		if !tMetric.KeepCase {
+			value = low(value)
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// possible TableInfo.RowCountMatch modes
+var matchModes = map[string]bool{
+	"exact":    true,
+	"prefix":   true,
+	"contains": true,
+	"suffix":   true,
+	"regex":    true,
+}
+
+// row count field and value of a regular expression
+type rowCountKey struct {
+	field string
+	value string
+}
+
+// check the match modes of the row count fields and compile regular expressions
+func (ti *TableInfo) checkRowCountMatch() bool {
+	fields := make(map[string]bool)
+	for field := range ti.RowCount {
+		fields[low(field)] = true
+	}
+
+	match := make(map[string]string)
+	for field, mode := range ti.RowCountMatch {
+		if !fields[low(field)] {
+			log.WithFields(log.Fields{
+				"field": field,
+			}).Error("TableInfo: RowCountMatch field is not part of RowCount")
+			return false
+		}
+		if !matchModes[low(mode)] {
+			log.WithFields(log.Fields{
+				"field": field,
+				"mode":  mode,
+			}).Error("TableInfo: RowCountMatch must be exact, prefix, contains, suffix or regex")
+			return false
+		}
+		match[low(field)] = low(mode)
+	}
+	ti.RowCountMatch = match
+
+	ti.rowCountRegexps = make(map[rowCountKey]*regexp.Regexp)
+	for field, values := range ti.RowCount {
+		if "regex" != ti.RowCountMatch[low(field)] {
+			continue
+		}
+		for _, value := range values {
+			re, err := regexp.Compile("(?i)" + interface2String(value))
+			if err != nil {
+				log.WithFields(log.Fields{
+					"field": field,
+					"value": value,
+					"error": err,
+				}).Error("TableInfo: wrong RowCount regular expression")
+				return false
+			}
+			ti.rowCountRegexps[rowCountKey{low(field), low(interface2String(value))}] = re
+		}
+	}
+	return true
+}
+
+// true if the field value matches the row count value in the match mode of the field
+func (tMetric TableInfo) rowCountMatch(field, namePart, fieldValue string) bool {
+	switch tMetric.RowCountMatch[low(field)] {
+	case "exact":
+		return fieldValue == namePart
+	case "contains":
+		return strings.Contains(fieldValue, namePart)
+	case "suffix":
+		return strings.HasSuffix(fieldValue, namePart)
+	case "regex":
+		re, ok := tMetric.rowCountRegexps[rowCountKey{low(field), namePart}]
+		return ok && re.MatchString(fieldValue)
+	default:
+		return strings.HasPrefix(fieldValue, namePart)
+	}
+}
+
+// row count records with the field names as label names and the counted values
+// as label values, all records have the labels of all row count fields
+func (tMetric TableInfo) fieldLabelData(count map[string]float64, system SystemInfo, srvName string) []metricRecord {
+
+	var fields []string
+	for field := range tMetric.RowCount {
+		fields = append(fields, low(field))
+	}
+	sort.Strings(fields)
+
+	labels := append([]string{"system", "usage", "server"}, labelNames(fields)...)
+
+	var md []metricRecord
+	for fPos, field := range fields {
+		for _, value := range tMetric.rowCountValues(field) {
+			namePart := low(interface2String(value))
+
+			labelValues := append([]string{system.Name, system.Usage, srvName}, make([]string, len(fields))...)
+			labelValues[3+fPos] = namePart
+
+			md = append(md, metricRecord{
+				labels:      labels,
+				labelValues: labelValues,
+				value:       count[field+"_"+namePart],
+			})
+		}
+	}
+	return md
+}
+
+// row count values of a field
+func (tMetric TableInfo) rowCountValues(field string) []interface{} {
+	for f, values := range tMetric.RowCount {
+		if low(f) == field {
+			return values
+		}
+	}
+	return nil
+}
+
+// check buckets of a histogram or quantiles of a summary
+func (ti *TableInfo) checkDistribution() bool {
+	if 0 == len(ti.ValueColumn) || (len(ti.Buckets) > 0 && len(ti.Quantiles) > 0) {
+		log.WithFields(log.Fields{
+			"ValueColumn": ti.ValueColumn,
+			"Buckets":     ti.Buckets,
+			"Quantiles":   ti.Quantiles,
+		}).Error("TableInfo: Buckets or Quantiles need a ValueColumn")
+		return false
+	}
+
+	sort.Float64s(ti.Buckets)
+	for i := 1; i < len(ti.Buckets); i++ {
+		if ti.Buckets[i] == ti.Buckets[i-1] {
+			log.WithFields(log.Fields{
+				"Buckets": ti.Buckets,
+			}).Error("TableInfo: Buckets must be unique")
+			return false
+		}
+	}
+
+	for _, q := range ti.Quantiles {
+		if q < 0 || q > 1 {
+			log.WithFields(log.Fields{
+				"Quantiles": ti.Quantiles,
+			}).Error("TableInfo: Quantiles must be between 0 and 1")
+			return false
+		}
+	}
+	return true
+}
+
+// histogram or summary of the value column, one record per group
+func (tMetric TableInfo) distributionData(rows []map[string]interface{}, system SystemInfo, srvName string) []metricRecord {
+
+	groups := make(map[string][]float64)
+	groupValues := make(map[string][]string)
+
+	for _, line := range rows {
+		f64Val, err := tMetric.conv.number(tMetric.ValueColumn, line[up(tMetric.ValueColumn)])
+		if err != nil {
+			log.WithFields(log.Fields{
+				"system":      system.Name,
+				"server":      srvName,
+				"valueColumn": tMetric.ValueColumn,
+				"error":       err,
+			}).Debug("distributionData: row value is not a number")
+			continue
+		}
+
+		values := tMetric.columnValues(line, tMetric.GroupBy)
+		key := strings.Join(values, "\x00")
+		if _, ok := groupValues[key]; !ok {
+			groupValues[key] = values
+		}
+		groups[key] = append(groups[key], f64Val)
+	}
+
+	// without groups an empty distribution is always reported
+	if 0 == len(groups) && 0 == len(tMetric.GroupBy) {
+		groups[""] = nil
+	}
+
+	var keys []string
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if tMetric.MaxGroups > 0 && uint(len(keys)) > tMetric.MaxGroups {
+		log.WithFields(log.Fields{
+			"system":    system.Name,
+			"server":    srvName,
+			"table":     tMetric.Table,
+			"groups":    len(keys),
+			"maxGroups": tMetric.MaxGroups,
+		}).Warn("distributionData: too many groups - surplus groups are skipped")
+		keys = keys[:tMetric.MaxGroups]
+	}
+
+	labels := append([]string{"system", "usage", "server"}, labelNames(tMetric.GroupBy)...)
+
+	var md []metricRecord
+	for _, key := range keys {
+		values := groups[key]
+		sort.Float64s(values)
+
+		data := metricRecord{
+			labels:      labels,
+			labelValues: append([]string{system.Name, system.Usage, srvName}, groupValues[key]...),
+			count:       uint64(len(values)),
+		}
+		for _, val := range values {
+			data.sum += val
+		}
+
+		if len(tMetric.Buckets) > 0 {
+			data.buckets = make(map[float64]uint64)
+			for _, bound := range tMetric.Buckets {
+				data.buckets[bound] = uint64(sort.SearchFloat64s(values, math.Nextafter(bound, math.Inf(1))))
+			}
+		} else {
+			data.quantiles = make(map[float64]float64)
+			for _, q := range tMetric.Quantiles {
+				data.quantiles[q] = quantile(values, q)
+			}
+		}
+		md = append(md, data)
+	}
+	return md
+}
+
+// quantile of sorted values (nearest rank), NaN without values
+func quantile(values []float64, q float64) float64 {
+	if 0 == len(values) {
+		return math.NaN()
+	}
+
+	rank := int(math.Ceil(q*float64(len(values)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return values[rank]
+}
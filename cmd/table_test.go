@@ -0,0 +1,441 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TableDataAggregate(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t,
+		tomlMetric{
+			Name:           "sap_process_cpu",
+			Help:           "cpu per process type",
+			MetricType:     "gauge",
+			FunctionModule: "TH_WPINFO",
+			TagFilter:      []string{"test"},
+			TableData: TableInfo{
+				Table:       "WPLIST",
+				Aggregate:   "SUM",
+				ValueColumn: "WP_CPU",
+				GroupBy:     []string{"WP_TYP"},
+			},
+		},
+		tomlMetric{
+			Name:           "sap_process_max_elapsed",
+			Help:           "max elapsed time of running processes",
+			MetricType:     "gauge",
+			FunctionModule: "TH_WPINFO",
+			TagFilter:      []string{"test"},
+			TableData: TableInfo{
+				Table:       "WPLIST",
+				Aggregate:   "max",
+				ValueColumn: "wp_eltime",
+				RowFilter: map[string][]interface{}{
+					"wp_status": {"running"},
+				},
+			},
+		},
+	)
+	config.Systems[0].Tags = []string{"test"}
+
+	for _, md := range config.collectMetrics() {
+		switch md.name {
+		case "sap_process_cpu":
+			assert.Equal(3, len(md.stats))
+			assert.Equal([]string{"system", "usage", "server", "wp_typ"}, md.stats[0].labels)
+			r, ok := findRecord(md.stats, "t01", "dia")
+			assert.True(ok)
+			assert.Equal(33.0, r.value)
+			r, _ = findRecord(md.stats, "t01", "bgd")
+			assert.Equal(305.0, r.value)
+			r, _ = findRecord(md.stats, "t01", "upd")
+			assert.Equal(0.0, r.value)
+		case "sap_process_max_elapsed":
+			assert.Equal(1, len(md.stats))
+			assert.Equal([]string{"system", "usage", "server"}, md.stats[0].labels)
+			assert.Equal(120.0, md.stats[0].value)
+		default:
+			t.Error("unexpected metric " + md.name)
+		}
+	}
+}
+
+func Test_TableDataGroupCount(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t,
+		tomlMetric{
+			Name:           "sap_users",
+			Help:           "users per client and gui version",
+			MetricType:     "gauge",
+			FunctionModule: "TH_USER_LIST",
+			TagFilter:      []string{"test"},
+			TableData: TableInfo{
+				Table:     "USRLIST",
+				Aggregate: "count",
+				GroupBy:   []string{"mandt", "guiversion"},
+			},
+		},
+		tomlMetric{
+			Name:           "sap_gui_versions",
+			Help:           "users per gui version",
+			MetricType:     "gauge",
+			FunctionModule: "TH_USER_LIST",
+			TagFilter:      []string{"test"},
+			TableData: TableInfo{
+				Table:     "USRLIST",
+				Aggregate: "count",
+				GroupBy:   []string{"guiversion"},
+				MaxGroups: 2,
+			},
+		},
+	)
+	config.Systems[0].Tags = []string{"test"}
+
+	for _, md := range config.collectMetrics() {
+		switch md.name {
+		case "sap_users":
+			assert.Equal(4, len(md.stats))
+			assert.Equal([]string{"system", "usage", "server", "mandt", "guiversion"}, md.stats[0].labels)
+			r, ok := findRecord(md.stats, "t01", "100", "7600")
+			assert.True(ok)
+			assert.Equal(1.0, r.value)
+			r, ok = findRecord(md.stats, "t01", "000", "7600")
+			assert.True(ok)
+			assert.Equal(1.0, r.value)
+		case "sap_gui_versions":
+			// the third version 7700 exceeds the cap
+			assert.Equal(2, len(md.stats))
+			r, _ := findRecord(md.stats, "t01", "7600")
+			assert.Equal(2.0, r.value)
+			r, _ = findRecord(md.stats, "t01", "7500")
+			assert.Equal(1.0, r.value)
+			_, ok := findRecord(md.stats, "t01", "7700")
+			assert.False(ok)
+		default:
+			t.Error("unexpected metric " + md.name)
+		}
+	}
+}
+
+func Test_ColumnValues(t *testing.T) {
+	assert := assert.New(t)
+
+	line := map[string]interface{}{"WP_TYP": "DIA", "WP_ELTIME": 1.5, "WP_NO": 3}
+	ti := TableInfo{}
+	assert.Equal([]string{"dia", "1.5", "3"}, ti.columnValues(line, []string{"wp_typ", "wp_eltime", "wp_no"}))
+	assert.NotEqual(ti.columnValues(line, []string{"wp_eltime"}), ti.columnValues(map[string]interface{}{"WP_ELTIME": 2.5}, []string{"wp_eltime"}))
+
+	ti.KeepCase = true
+	assert.Equal([]string{"DIA", "1.5"}, ti.columnValues(line, []string{"wp_typ", "wp_eltime"}))
+}
+
+func Test_TableDataRows(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t,
+		tomlMetric{
+			Name:           "sap_process_elapsed",
+			Help:           "elapsed time per process",
+			MetricType:     "gauge",
+			FunctionModule: "TH_WPINFO",
+			TagFilter:      []string{"test"},
+			TableData: TableInfo{
+				Table:       "WPLIST",
+				RowLabels:   []string{"WP_TYP", "wp_status", "wp_table"},
+				ValueColumn: "wp_eltime",
+			},
+		},
+		tomlMetric{
+			Name:           "sap_process_first_elapsed",
+			Help:           "elapsed time of the first process per type",
+			MetricType:     "gauge",
+			FunctionModule: "TH_WPINFO",
+			TagFilter:      []string{"test"},
+			TableData: TableInfo{
+				Table:       "WPLIST",
+				RowLabels:   []string{"wp_typ"},
+				ValueColumn: "wp_eltime",
+				MaxGroups:   2,
+			},
+		},
+	)
+	config.Systems[0].Tags = []string{"test"}
+
+	for _, md := range config.collectMetrics() {
+		switch md.name {
+		case "sap_process_elapsed":
+			assert.Equal(6, len(md.stats))
+			assert.Equal([]string{"system", "usage", "server", "wp_typ", "wp_status", "wp_table"}, md.stats[0].labels)
+			r, ok := findRecord(md.stats, "t01", "dia", "running", "dbvl")
+			assert.True(ok)
+			assert.Equal(7.0, r.value)
+			r, ok = findRecord(md.stats, "t01", "bgd", "on hold")
+			assert.True(ok)
+			assert.Equal(40.0, r.value)
+		case "sap_process_first_elapsed":
+			// duplicate rows are skipped and the cap stops before upd
+			assert.Equal(2, len(md.stats))
+			r, _ := findRecord(md.stats, "t01", "dia")
+			assert.Equal(3.0, r.value)
+			r, _ = findRecord(md.stats, "t01", "bgd")
+			assert.Equal(120.0, r.value)
+		default:
+			t.Error("unexpected metric " + md.name)
+		}
+	}
+}
+
+func Test_TableDataRowCountMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t,
+		tomlMetric{
+			Name:           "sap_lock_entries",
+			Help:           "sm12",
+			MetricType:     "gauge",
+			FunctionModule: "ENQUE_READ",
+			TagFilter:      []string{"test"},
+			TableData: TableInfo{
+				Table: "ENQ",
+				RowCount: map[string][]interface{}{
+					"gclient": {"10", "100"},
+				},
+				RowCountMatch: map[string]string{
+					"gclient": "Exact",
+				},
+			},
+		},
+		tomlMetric{
+			Name:           "sap_processes",
+			Help:           "sm50",
+			MetricType:     "gauge",
+			FunctionModule: "TH_WPINFO",
+			TagFilter:      []string{"test"},
+			TableData: TableInfo{
+				Table: "WPLIST",
+				RowCount: map[string][]interface{}{
+					"wp_status": {"ait"},
+					"wp_typ":    {"^(dia|upd)$"},
+					"wp_table":  {"db"},
+					"wp_cpu":    {"0"},
+				},
+				RowCountMatch: map[string]string{
+					"wp_status": "contains",
+					"wp_typ":    "regex",
+					"wp_cpu":    "suffix",
+				},
+			},
+		},
+	)
+	config.Systems[0].Tags = []string{"test"}
+
+	for _, md := range config.collectMetrics() {
+		switch md.name {
+		case "sap_lock_entries":
+			r, _ := findRecord(md.stats, "t01", "gclient_10")
+			assert.Equal(0.0, r.value)
+			r, _ = findRecord(md.stats, "t01", "gclient_100")
+			assert.Equal(2.0, r.value)
+		case "sap_processes":
+			r, _ := findRecord(md.stats, "t01", "wp_status_ait")
+			assert.Equal(2.0, r.value)
+			r, _ = findRecord(md.stats, "t01", "wp_typ_^(dia|upd)$")
+			assert.Equal(4.0, r.value)
+			// default prefix match
+			r, _ = findRecord(md.stats, "t01", "wp_table_db")
+			assert.Equal(1.0, r.value)
+			r, _ = findRecord(md.stats, "t01", "wp_cpu_0")
+			assert.Equal(3.0, r.value)
+		default:
+			t.Error("unexpected metric " + md.name)
+		}
+	}
+}
+
+func Test_TableDataFieldAsLabel(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t, tomlMetric{
+		Name:           "sap_processes",
+		Help:           "sm50",
+		MetricType:     "gauge",
+		FunctionModule: "TH_WPINFO",
+		TagFilter:      []string{"test"},
+		TableData: TableInfo{
+			Table: "WPLIST",
+			RowCount: map[string][]interface{}{
+				"wp_typ":   {"dia", "bgd"},
+				"WP_TABLE": {"dbvl"},
+			},
+			RowFilter: map[string][]interface{}{
+				"wp_status": {"running"},
+			},
+			FieldAsLabel: true,
+		},
+	})
+	config.Systems[0].Tags = []string{"test"}
+
+	data := config.collectMetrics()
+	assert.Equal(1, len(data))
+	assert.Equal(3, len(data[0].stats))
+
+	values := make(map[string]float64)
+	for _, r := range data[0].stats {
+		assert.Equal([]string{"system", "usage", "server", "wp_table", "wp_typ"}, r.labels)
+		values[strings.Join(r.labelValues, ",")] = r.value
+	}
+	assert.Equal(map[string]float64{
+		"t01,test,t01,,dia":  2,
+		"t01,test,t01,,bgd":  1,
+		"t01,test,t01,dbvl,": 1,
+	}, values)
+}
+
+func Test_TableDataHistogram(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t, tomlMetric{
+		Name:           "sap_process_elapsed_seconds",
+		Help:           "elapsed time of the processes",
+		MetricType:     "histogram",
+		FunctionModule: "TH_WPINFO",
+		TagFilter:      []string{"test"},
+		TableData: TableInfo{
+			Table:       "WPLIST",
+			ValueColumn: "wp_eltime",
+			Buckets:     []float64{100, 1, 10},
+		},
+	})
+	config.Systems[0].Tags = []string{"test"}
+
+	expected := `
+# HELP sap_process_elapsed_seconds elapsed time of the processes
+# TYPE sap_process_elapsed_seconds histogram
+sap_process_elapsed_seconds_bucket{server="t01",system="t01",usage="test",le="1"} 2
+sap_process_elapsed_seconds_bucket{server="t01",system="t01",usage="test",le="10"} 4
+sap_process_elapsed_seconds_bucket{server="t01",system="t01",usage="test",le="100"} 5
+sap_process_elapsed_seconds_bucket{server="t01",system="t01",usage="test",le="+Inf"} 6
+sap_process_elapsed_seconds_sum{server="t01",system="t01",usage="test"} 170
+sap_process_elapsed_seconds_count{server="t01",system="t01",usage="test"} 6
+`
+	c := newCollector(config.collectMetrics)
+	assert.NoError(testutil.CollectAndCompare(c, strings.NewReader(expected)))
+}
+
+func Test_TableDataSummary(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t, tomlMetric{
+		Name:           "sap_process_elapsed_seconds",
+		Help:           "elapsed time of the processes",
+		MetricType:     "summary",
+		FunctionModule: "TH_WPINFO",
+		TagFilter:      []string{"test"},
+		TableData: TableInfo{
+			Table:       "WPLIST",
+			ValueColumn: "wp_eltime",
+			GroupBy:     []string{"wp_typ"},
+			Quantiles:   []float64{0.5, 0.9},
+		},
+	})
+	config.Systems[0].Tags = []string{"test"}
+
+	data := config.collectMetrics()
+	assert.Equal(1, len(data))
+	assert.Equal(3, len(data[0].stats))
+
+	r, ok := findRecord(data[0].stats, "t01", "dia")
+	assert.True(ok)
+	assert.Equal(uint64(3), r.count)
+	assert.Equal(10.0, r.sum)
+	assert.Equal(map[float64]float64{0.5: 3, 0.9: 7}, r.quantiles)
+}
+
+func Test_DistributionCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	table := TableInfo{Table: "WPLIST", ValueColumn: "wp_eltime", Buckets: []float64{1}}
+	for _, tm := range []tomlMetric{
+		{MetricType: "gauge", TableData: table},
+		{MetricType: "histogram", TableData: TableInfo{Table: "WPLIST", ValueColumn: "wp_eltime", Quantiles: []float64{0.5}}},
+		{MetricType: "summary", TableData: table},
+		{MetricType: "histogram", TableData: TableInfo{Table: "WPLIST", Aggregate: "sum", ValueColumn: "wp_eltime"}},
+		{MetricType: "histogram", TableData: TableInfo{Table: "WPLIST", Buckets: []float64{1}}},
+		{MetricType: "histogram", TableData: TableInfo{Table: "WPLIST", ValueColumn: "wp_eltime", Buckets: []float64{1, 1}}},
+		{MetricType: "summary", TableData: TableInfo{Table: "WPLIST", ValueColumn: "wp_eltime", Quantiles: []float64{1.5}}},
+	} {
+		tm.Name = "sap_process_elapsed_seconds"
+		tm.Help = "elapsed"
+		tm.FunctionModule = "TH_WPINFO"
+		_, err := checkTomlMetric(tm)
+		assert.Error(err, tm.MetricType)
+	}
+
+	_, err := checkTomlMetric(tomlMetric{Name: "sap_process_elapsed_seconds", Help: "elapsed", MetricType: "Histogram", FunctionModule: "TH_WPINFO", TableData: table})
+	assert.NoError(err)
+}
+
+func Test_Aggregation(t *testing.T) {
+	assert := assert.New(t)
+
+	var a aggregation
+	for _, val := range []float64{4, -2, 10} {
+		a.add(val)
+	}
+	assert.Equal(3.0, aggregators["count"](a))
+	assert.Equal(12.0, aggregators["sum"](a))
+	assert.Equal(4.0, aggregators["avg"](a))
+	assert.Equal(-2.0, aggregators["min"](a))
+	assert.Equal(10.0, aggregators["max"](a))
+}
+
+func Test_TableInfoCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	ti := TableInfo{Table: "wplist", Aggregate: "Avg", ValueColumn: "WP_CPU", GroupBy: []string{"WP_TYP"}}
+	assert.True(ti.checkSpecialData())
+	assert.Equal("WPLIST", ti.Table)
+	assert.Equal("avg", ti.Aggregate)
+	assert.Equal("wp_cpu", ti.ValueColumn)
+	assert.Equal([]string{"wp_typ"}, ti.GroupBy)
+	assert.Equal(uint(defaultMaxGroups), ti.MaxGroups)
+
+	assert.True((&TableInfo{Table: "usrlist", Aggregate: "count", GroupBy: []string{"mandt"}}).checkSpecialData())
+	assert.False((&TableInfo{Table: "usrlist", Aggregate: "count"}).checkSpecialData())
+	assert.True((&TableInfo{Table: "wplist", RowLabels: []string{"wp_no"}, ValueColumn: "wp_cpu"}).checkSpecialData())
+	assert.False((&TableInfo{Table: "wplist", RowLabels: []string{"wp_no"}}).checkSpecialData())
+	assert.False((&TableInfo{Table: "wplist", RowLabels: []string{"wp_no"}, Aggregate: "sum", ValueColumn: "wp_cpu"}).checkSpecialData())
+
+	rowCount := map[string][]interface{}{"wp_typ": {"dia"}}
+	assert.True((&TableInfo{Table: "wplist", RowCount: rowCount, RowCountMatch: map[string]string{"WP_TYP": "exact"}}).checkSpecialData())
+	assert.False((&TableInfo{Table: "wplist", RowCount: rowCount, RowCountMatch: map[string]string{"wp_typ": "fuzzy"}}).checkSpecialData())
+	assert.False((&TableInfo{Table: "wplist", RowCount: rowCount, RowCountMatch: map[string]string{"wp_status": "exact"}}).checkSpecialData())
+	assert.False((&TableInfo{Table: "wplist", RowCount: map[string][]interface{}{"wp_typ": {"(dia"}}, RowCountMatch: map[string]string{"wp_typ": "regex"}}).checkSpecialData())
+
+	// row counts are not converted
+	assert.False((&TableInfo{Table: "wplist", RowCount: rowCount, Scale: map[string]float64{"bogus": 2}}).checkSpecialData())
+	assert.False((&TableInfo{Table: "wplist", RowCount: rowCount, Units: map[string]string{"wp_typ": "kb"}}).checkSpecialData())
+	assert.False((&TableInfo{Table: "wplist", RowCount: rowCount, ValueMap: valueMap{"wp_typ": {"dia": 1}}}).checkSpecialData())
+
+	// field as label only with row count
+	assert.False((&TableInfo{Table: "wplist", Aggregate: "count", GroupBy: []string{"wp_typ"}, FieldAsLabel: true}).checkSpecialData())
+	assert.True((&TableInfo{Table: "wplist", RowCount: rowCount, FieldAsLabel: true}).checkSpecialData())
+
+	// regular expressions of fields and values with underscores do not collide
+	ti = TableInfo{Table: "wplist", RowCount: map[string][]interface{}{"wp": {"typ_x"}, "wp_typ": {"x"}}, RowCountMatch: map[string]string{"wp": "regex", "wp_typ": "regex"}}
+	assert.True(ti.checkSpecialData())
+	assert.Equal(2, len(ti.rowCountRegexps))
+	assert.True(ti.rowCountMatch("wp", "typ_x", "typ_x"))
+	assert.False(ti.rowCountMatch("wp", "typ_x", "x"))
+
+	assert.False((&TableInfo{Table: "wplist", Aggregate: "median", ValueColumn: "wp_cpu"}).checkSpecialData())
+	assert.False((&TableInfo{Table: "wplist", Aggregate: "sum"}).checkSpecialData())
+	assert.False((&TableInfo{Table: "wplist", Aggregate: "sum", ValueColumn: "wp_cpu",
+		RowCount: map[string][]interface{}{"wp_typ": {"dia"}}}).checkSpecialData())
+}
@@ -0,0 +1,198 @@
+// Copyright © 2020 Ulrich Anhalt <ulrich.anhalt@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// valid prometheus metric name
+var validMetricRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// prefix of the exporter self-monitoring metrics
+const exporterPrefix = "sapnwrfc_"
+
+// suffixes of the series of histograms and summaries
+var seriesSuffixes = []string{"_bucket", "_count", "_sum"}
+
+// check namespace and add it to the metric names
+func (config *Config) addNamespace() error {
+	if 0 == len(config.Namespace) {
+		return nil
+	}
+
+	config.Namespace = low(config.Namespace)
+	if !validLabelRe.MatchString(config.Namespace) || exporterPrefix == config.Namespace+"_" {
+		log.WithFields(log.Fields{
+			"namespace": config.Namespace,
+		}).Error("Namespace: only letters, digits and underscores are allowed, sapnwrfc is reserved")
+		return errors.New("addNamespace(" + config.Namespace + ")")
+	}
+
+	for i := range config.IntMetrics {
+		config.IntMetrics[i].Name = config.Namespace + "_" + config.IntMetrics[i].Name
+	}
+	return nil
+}
+
+// check metric names for prometheus conventions and duplicates
+func (config *Config) checkMetricNames() error {
+	names := make(map[string]string)
+	for _, mi := range config.IntMetrics {
+		if !validMetricRe.MatchString(mi.Name) || strings.HasPrefix(mi.Name, "__") {
+			return metricNameError(mi.Name, "only letters, digits, underscores and colons are allowed")
+		}
+		if strings.HasPrefix(mi.Name, exporterPrefix) {
+			return metricNameError(mi.Name, "the prefix "+exporterPrefix+" is reserved for the exporter metrics")
+		}
+		if strings.HasSuffix(mi.Name, "_total") && "counter" != mi.MetricType {
+			return metricNameError(mi.Name, "the suffix _total is reserved for counters")
+		}
+		if "histogram" == mi.MetricType || "summary" == mi.MetricType {
+			for _, suffix := range seriesSuffixes {
+				if strings.HasSuffix(mi.Name, suffix) {
+					return metricNameError(mi.Name, "the suffix "+suffix+" is reserved for the series of histograms and summaries")
+				}
+			}
+		}
+		if _, ok := names[mi.Name]; ok {
+			return metricNameError(mi.Name, "the metric name is used more than once")
+		}
+		names[mi.Name] = mi.MetricType
+	}
+
+	// the series of histograms and summaries must not collide with other metrics
+	for name, metricType := range names {
+		if "histogram" != metricType && "summary" != metricType {
+			continue
+		}
+		for _, suffix := range seriesSuffixes {
+			if _, ok := names[name+suffix]; ok {
+				return metricNameError(name+suffix, "the metric name collides with the series of "+metricType+" "+name)
+			}
+		}
+	}
+	return nil
+}
+
+// log and return metric name error
+func metricNameError(name, reason string) error {
+	log.WithFields(log.Fields{
+		"name":   name,
+		"reason": reason,
+	}).Error("Wrong metric name")
+	return errors.New("checkMetricNames(" + name + ")")
+}
+
+// check label names of the metric data, const labels and system labels
+// every label name must be valid and unique
+func (config *Config) checkMetricLabels() error {
+	for _, mi := range config.IntMetrics {
+		labels := append(append([]string{}, standardLabels...), mi.special.dataLabels()...)
+		for name := range mi.ConstLabels {
+			labels = append(labels, name)
+		}
+		labels = append(labels, config.sysLabels...)
+
+		known := make(map[string]bool)
+		for _, label := range labels {
+			if !validLabelRe.MatchString(label) || strings.HasPrefix(label, "__") || known[label] {
+				log.WithFields(log.Fields{
+					"name":   mi.Name,
+					"label":  label,
+					"labels": labels,
+				}).Error("Wrong or duplicate label name")
+				return errors.New("checkMetricLabels(" + mi.Name + " label " + label + ")")
+			}
+			known[label] = true
+		}
+
+		// histograms and summaries add the labels le and quantile
+		if ("histogram" == mi.MetricType && known["le"]) || ("summary" == mi.MetricType && known["quantile"]) {
+			log.WithFields(log.Fields{
+				"name":        mi.Name,
+				"metric type": mi.MetricType,
+				"labels":      labels,
+			}).Error("Label names le and quantile are reserved for histograms and summaries")
+			return errors.New("checkMetricLabels(" + mi.Name + " reserved label)")
+		}
+
+		// every field label value is recorded only once
+		fields := make(map[string]bool)
+		for _, field := range mi.special.dataFields() {
+			if fields[field] {
+				log.WithFields(log.Fields{
+					"name":  mi.Name,
+					"field": field,
+				}).Error("Field or derived value is used more than once")
+				return errors.New("checkMetricLabels(" + mi.Name + " field " + field + ")")
+			}
+			fields[field] = true
+		}
+	}
+	return nil
+}
+
+// label names of the table data records without the standard labels
+func (tMetric TableInfo) dataLabels() []string {
+	switch {
+	case len(tMetric.RowLabels) > 0:
+		return labelNames(tMetric.RowLabels)
+	case len(tMetric.Aggregate) > 0, len(tMetric.Buckets) > 0, len(tMetric.Quantiles) > 0:
+		return labelNames(tMetric.GroupBy)
+	case tMetric.FieldAsLabel:
+		var fields []string
+		for field := range tMetric.RowCount {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		return labelNames(fields)
+	default:
+		return []string{"count"}
+	}
+}
+
+// label names of the field data records without the standard labels
+func (fMetric FieldInfo) dataLabels() []string {
+	if len(fMetric.FieldLabels) > 0 {
+		return labelNames(fMetric.FieldLabels)
+	}
+	return []string{"field"}
+}
+
+// label names of the structure data records without the standard labels
+func (sMetric StructureInfo) dataLabels() []string {
+	return []string{"field"}
+}
+
+// field label values of the table data records
+func (tMetric TableInfo) dataFields() []string {
+	return nil
+}
+
+// field label values of the field values and derived values
+func (fMetric FieldInfo) dataFields() []string {
+	return append(append([]string{}, fMetric.FieldValues...), fMetric.derived.names...)
+}
+
+// field label values of the structure fields and derived values
+func (sMetric StructureInfo) dataFields() []string {
+	return append(append([]string{}, sMetric.StructureFields...), sMetric.derived.names...)
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// metric with field values and the given name and type
+func namedMetric(name, metricType string) tomlMetric {
+	tm := tomlMetric{
+		Name:           name,
+		Help:           "help",
+		MetricType:     metricType,
+		FunctionModule: "SAPTUNE_GET_STORAGE_INFOS",
+		FieldData:      FieldInfo{FieldValues: []string{"page_bufsz"}},
+	}
+	if "histogram" == metricType {
+		tm.FunctionModule = "TH_WPINFO"
+		tm.FieldData = FieldInfo{}
+		tm.TableData = TableInfo{Table: "WPLIST", ValueColumn: "wp_eltime", Buckets: []float64{1}}
+	}
+	return tm
+}
+
+func Test_CheckMetricNames(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		metrics []tomlMetric
+		ok      bool
+	}{
+		{[]tomlMetric{namedMetric("sap_storage", "gauge"), namedMetric("sap:storage_count", "gauge")}, true},
+		{[]tomlMetric{namedMetric("sap_storage_total", "counter")}, true},
+		{[]tomlMetric{namedMetric("sap-storage", "gauge")}, false},
+		{[]tomlMetric{namedMetric("1sap_storage", "gauge")}, false},
+		{[]tomlMetric{namedMetric("sapnwrfc_up", "gauge")}, false},
+		{[]tomlMetric{namedMetric("sap_storage_total", "gauge")}, false},
+		{[]tomlMetric{namedMetric("sap_elapsed_sum", "histogram")}, false},
+		{[]tomlMetric{namedMetric("sap_storage", "gauge"), namedMetric("SAP_Storage", "counter")}, false},
+		{[]tomlMetric{namedMetric("sap_elapsed", "histogram"), namedMetric("sap_elapsed_count", "gauge")}, false},
+	}
+	for _, test := range tests {
+		config := &Config{Metrics: test.metrics}
+		err := config.fillInternalMetrics()
+		assert.Equal(test.ok, err == nil, test.metrics[len(test.metrics)-1].Name)
+	}
+}
+
+func Test_Namespace(t *testing.T) {
+	assert := assert.New(t)
+
+	config := &Config{Namespace: "ACME", Metrics: []tomlMetric{namedMetric("sap_storage", "gauge")}}
+	assert.NoError(config.fillInternalMetrics())
+	assert.Equal("acme_sap_storage", config.IntMetrics[0].Name)
+
+	for _, namespace := range []string{"acme-corp", "sapnwrfc"} {
+		config = &Config{Namespace: namespace, Metrics: []tomlMetric{namedMetric("sap_storage", "gauge")}}
+		assert.Error(config.fillInternalMetrics(), namespace)
+	}
+}
+
+func Test_CheckMetricLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		special      func(tm *tomlMetric)
+		systemLabels map[string]string
+		ok           bool
+	}{
+		{func(tm *tomlMetric) {}, map[string]string{"datacenter": "dc1"}, true},
+		{func(tm *tomlMetric) { tm.ConstLabels = map[string]string{"field": "x"} }, nil, false},
+		{func(tm *tomlMetric) { tm.ConstLabels = map[string]string{"team": "basis"} }, map[string]string{"team": "erp"}, false},
+		{func(tm *tomlMetric) {}, map[string]string{"field": "x"}, false},
+		{func(tm *tomlMetric) {
+			tm.FieldData = FieldInfo{FieldLabels: []string{"es_info.host", "es_info_host"}}
+		}, nil, false},
+		{func(tm *tomlMetric) {
+			tm.FieldData = FieldInfo{FieldLabels: []string{"system"}}
+		}, nil, false},
+		{func(tm *tomlMetric) {
+			tm.FunctionModule = "TH_WPINFO"
+			tm.FieldData = FieldInfo{}
+			tm.TableData = TableInfo{Table: "WPLIST", RowLabels: []string{"wp_typ", "usage"}, ValueColumn: "wp_eltime"}
+		}, nil, false},
+		{func(tm *tomlMetric) {
+			tm.FunctionModule = "TH_WPINFO"
+			tm.FieldData = FieldInfo{}
+			tm.TableData = TableInfo{Table: "WPLIST", Aggregate: "count", GroupBy: []string{"wp_typ", "wp_status"}}
+		}, nil, true},
+		{func(tm *tomlMetric) {
+			tm.MetricType = "histogram"
+			tm.FunctionModule = "TH_WPINFO"
+			tm.FieldData = FieldInfo{}
+			tm.TableData = TableInfo{Table: "WPLIST", ValueColumn: "wp_eltime", Buckets: []float64{1, 10}, GroupBy: []string{"le"}}
+		}, nil, false},
+		{func(tm *tomlMetric) {
+			tm.MetricType = "summary"
+			tm.FunctionModule = "TH_WPINFO"
+			tm.FieldData = FieldInfo{}
+			tm.TableData = TableInfo{Table: "WPLIST", ValueColumn: "wp_eltime", Quantiles: []float64{0.5}, GroupBy: []string{"Quantile"}}
+		}, nil, false},
+		{func(tm *tomlMetric) {
+			tm.MetricType = "summary"
+			tm.FunctionModule = "TH_WPINFO"
+			tm.FieldData = FieldInfo{}
+			tm.TableData = TableInfo{Table: "WPLIST", ValueColumn: "wp_eltime", Quantiles: []float64{0.5}, GroupBy: []string{"le"}}
+		}, nil, true},
+		{func(tm *tomlMetric) {
+			tm.FieldData = FieldInfo{FieldValues: []string{"page_bufsz"}, Derived: map[string]string{"Page_Bufsz": "page_bufsz * 2"}}
+		}, nil, false},
+		{func(tm *tomlMetric) {
+			tm.FieldData = FieldInfo{FieldValues: []string{"page_bufsz"}, Derived: map[string]string{"page_bufsz_double": "page_bufsz * 2"}}
+		}, nil, true},
+		{func(tm *tomlMetric) {
+			tm.FunctionModule = "Z_MONITOR_INFO"
+			tm.FieldData = FieldInfo{}
+			tm.StructureData = StructureInfo{ExportStructure: "es_info.memory", StructureFields: []string{"used", "total"}, Derived: map[string]string{"used": "total - used"}}
+		}, nil, false},
+	}
+	for i, test := range tests {
+		tm := namedMetric("sap_storage", "gauge")
+		test.special(&tm)
+
+		config := &Config{Metrics: []tomlMetric{tm}, Systems: []SystemInfo{{Name: "t01", Labels: test.systemLabels}}}
+		assert.NoError(config.fillInternalMetrics())
+		assert.NoError(config.checkSystemLabels())
+		assert.Equal(test.ok, config.checkMetricLabels() == nil, i)
+	}
+}
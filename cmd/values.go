@@ -0,0 +1,302 @@
+// Copyright © 2020 Ulrich Anhalt <ulrich.anhalt@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// string representation of a field value for labels and comparisons
+func formatValue(value interface{}) string {
+	switch val := value.(type) {
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32)
+	case time.Time:
+		switch {
+		case 0 == val.Year():
+			return val.Format("15:04:05")
+		case 0 == val.Hour() && 0 == val.Minute() && 0 == val.Second() && 0 == val.Nanosecond():
+			return val.Format("2006-01-02")
+		}
+		return val.Format("2006-01-02T15:04:05")
+	case nil:
+		return ""
+	case string:
+		return val
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// value of field values without an entry in the value map
+const valueMapDefault = "default"
+
+// numbers of the string values of fields
+type valueMap map[string]map[string]float64
+
+// lowercase fields and values of the value map, all fields must be known
+func checkValueMap(vm valueMap, fields []string) (valueMap, bool) {
+	known := make(map[string]bool)
+	for _, field := range fields {
+		known[low(field)] = true
+	}
+
+	checked := make(valueMap)
+	for field, values := range vm {
+		if !known[low(field)] {
+			log.WithFields(log.Fields{
+				"field": field,
+			}).Error("ValueMap: field is not a value field of the metric")
+			return nil, false
+		}
+
+		checked[low(field)] = make(map[string]float64)
+		for value, number := range values {
+			checked[low(field)][low(value)] = number
+		}
+	}
+	return checked, true
+}
+
+// number of a field value
+// fields with a value map are mapped, all others have to be numbers
+func (vm valueMap) number(field string, value interface{}) (float64, error) {
+	values, ok := vm[low(field)]
+	if !ok {
+		return i2Float64(value)
+	}
+
+	if number, ok := values[low(interface2String(value))]; ok {
+		return number, nil
+	}
+	if number, ok := values[valueMapDefault]; ok {
+		return number, nil
+	}
+	return 0, errors.New("valueMap - value is not mapped: " + interface2String(value))
+}
+
+// base unit and factor of a field unit
+// units with a parse function convert sap dates and times into seconds
+type unitInfo struct {
+	base   string
+	factor float64
+	parse  func(value interface{}) (float64, error)
+}
+
+// possible field units and their prometheus base units
+var units = map[string]unitInfo{
+	"b":       {"bytes", 1, nil},
+	"bytes":   {"bytes", 1, nil},
+	"kb":      {"bytes", 1024, nil},
+	"mb":      {"bytes", 1024 * 1024, nil},
+	"gb":      {"bytes", 1024 * 1024 * 1024, nil},
+	"tb":      {"bytes", 1024 * 1024 * 1024 * 1024, nil},
+	"us":      {"seconds", 1e-6, nil},
+	"ms":      {"seconds", 1e-3, nil},
+	"cs":      {"seconds", 1e-2, nil},
+	"s":       {"seconds", 1, nil},
+	"seconds": {"seconds", 1, nil},
+	"min":     {"seconds", 60, nil},
+	"h":       {"seconds", 3600, nil},
+	"d":       {"seconds", 86400, nil},
+	"percent": {"ratio", 1e-2, nil},
+	"ratio":   {"ratio", 1, nil},
+
+	"date":      {"seconds", 1, sapDate},
+	"time":      {"seconds", 1, sapTime},
+	"timestamp": {"seconds", 1, sapTimestamp},
+}
+
+// conversion of field values into metric values
+type valueConv struct {
+	valueMap valueMap
+	factors  map[string]float64
+	parsers  map[string]func(value interface{}) (float64, error)
+}
+
+// check value map, scale factors and units of the fields and combine them
+// into a value conversion
+func newValueConv(vm valueMap, scale map[string]float64, fieldUnits map[string]string, fields []string) (valueConv, bool) {
+	checked, ok := checkValueMap(vm, fields)
+	if !ok {
+		return valueConv{}, false
+	}
+	vc := valueConv{
+		valueMap: checked,
+		factors:  make(map[string]float64),
+		parsers:  make(map[string]func(value interface{}) (float64, error)),
+	}
+
+	known := make(map[string]bool)
+	for _, field := range fields {
+		known[low(field)] = true
+	}
+
+	for field, factor := range scale {
+		if !known[low(field)] || 0 == factor {
+			log.WithFields(log.Fields{
+				"field": field,
+				"scale": factor,
+			}).Error("Scale: field is not a value field of the metric or factor is 0")
+			return valueConv{}, false
+		}
+		vc.factors[low(field)] = factor
+	}
+
+	for field, unit := range fieldUnits {
+		ui, ok := units[low(unit)]
+		if !known[low(field)] || !ok {
+			log.WithFields(log.Fields{
+				"field": field,
+				"unit":  unit,
+			}).Error("Units: field is not a value field of the metric or unit is unknown")
+			return valueConv{}, false
+		}
+		if _, ok := vc.factors[low(field)]; !ok {
+			vc.factors[low(field)] = 1
+		}
+		vc.factors[low(field)] *= ui.factor
+		if ui.parse != nil {
+			vc.parsers[low(field)] = ui.parse
+		}
+	}
+	return vc, true
+}
+
+// number of a field value
+// fields with a value map are mapped, all others are converted to the base unit
+func (vc valueConv) number(field string, value interface{}) (float64, error) {
+	if _, ok := vc.valueMap[low(field)]; ok {
+		return vc.valueMap.number(field, value)
+	}
+
+	parse, ok := vc.parsers[low(field)]
+	if !ok {
+		parse = i2Float64
+	}
+	f64Val, err := parse(value)
+	if err != nil {
+		return f64Val, err
+	}
+	if factor, ok := vc.factors[low(field)]; ok {
+		f64Val *= factor
+	}
+	return f64Val, nil
+}
+
+// base unit of the field units, "" without field units
+func baseUnit(fieldUnits map[string]string) (string, error) {
+	base := ""
+	for field, unit := range fieldUnits {
+		ui, ok := units[low(unit)]
+		if !ok {
+			return "", errors.New("baseUnit - unknown unit " + unit + " of field " + field)
+		}
+		if len(base) > 0 && base != ui.base {
+			return "", errors.New("baseUnit - fields with different base units " + base + " and " + ui.base)
+		}
+		base = ui.base
+	}
+	return base, nil
+}
+
+// units of the table value column
+func (ti *TableInfo) fieldUnits() map[string]string {
+	return ti.Units
+}
+
+// units of the field values
+func (fi *FieldInfo) fieldUnits() map[string]string {
+	return fi.Units
+}
+
+// units of the structure fields
+func (si *StructureInfo) fieldUnits() map[string]string {
+	return si.Units
+}
+
+// check the metric unit and the base unit of the field units
+// the metric name must end with the unit (counters with unit_total)
+func checkUnit(name, metricType, unit string, fieldUnits map[string]string) error {
+	base, err := baseUnit(fieldUnits)
+	if err != nil {
+		return err
+	}
+
+	unit = low(unit)
+	if 0 == len(unit) {
+		unit = base
+	}
+	if len(base) > 0 && base != unit {
+		return errors.New("checkUnit - unit " + unit + " differs from the base unit " + base + " of the fields")
+	}
+	if 0 == len(unit) {
+		return nil
+	}
+
+	if strings.HasSuffix(name, "_"+unit) || ("counter" == metricType && strings.HasSuffix(name, "_"+unit+"_total")) {
+		return nil
+	}
+	return errors.New("checkUnit - metric name " + name + " must end with _" + unit)
+}
+
+// sap date (DATS) as unix seconds, e.g. "20201231"
+func sapDate(value interface{}) (float64, error) {
+	return sapTimeValue(value, "20060102", "2006-01-02")
+}
+
+// sap time (TIMS) as seconds since midnight, e.g. "235959"
+func sapTime(value interface{}) (float64, error) {
+	if t, ok := value.(time.Time); ok {
+		return float64(t.Hour()*3600 + t.Minute()*60 + t.Second()), nil
+	}
+	return sapTimeValue(value, "150405", "15:04:05")
+}
+
+// sap timestamp (TIMESTAMP, TIMESTAMPL) as unix seconds, e.g. 20201231235959
+func sapTimestamp(value interface{}) (float64, error) {
+	switch val := value.(type) {
+	case int64, int32, int, uint64, uint32, uint:
+		value = fmt.Sprint(val)
+	case float64:
+		value = strconv.FormatFloat(val, 'f', -1, 64)
+	}
+	return sapTimeValue(value, "20060102150405", "20060102150405.999999999", "2006-01-02T15:04:05Z07:00")
+}
+
+// unix seconds of a time or of a string in one of the layouts
+// sap dates and times have no time zone, they are interpreted as UTC
+func sapTimeValue(value interface{}, layouts ...string) (float64, error) {
+	switch val := value.(type) {
+	case time.Time:
+		return i2Float64(val)
+	case string:
+		for _, layout := range layouts {
+			if t, err := time.ParseInLocation(layout, strings.TrimSpace(val), time.UTC); err == nil {
+				return i2Float64(t)
+			}
+		}
+		return 0, errors.New("sapTimeValue - string is not a valid date or time: " + val)
+	}
+	return 0, errors.New("sapTimeValue - unknown type")
+}
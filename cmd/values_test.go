@@ -0,0 +1,340 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ValueMapNumber(t *testing.T) {
+	assert := assert.New(t)
+
+	vm, ok := checkValueMap(valueMap{
+		"WP_STATUS": {"Running": 1, "waiting": 0, "on hold": 2},
+		"wp_typ":    {"dia": 1, "default": -1},
+	}, []string{"wp_status", "wp_typ", "wp_cpu"})
+	assert.True(ok)
+
+	tests := []struct {
+		field  string
+		value  interface{}
+		number float64
+		ok     bool
+	}{
+		{"wp_status", "RUNNING", 1, true},
+		{"wp_status", " On Hold ", 2, true},
+		{"wp_status", "stopped", 0, false},
+		{"wp_typ", "bgd", -1, true},
+		{"wp_cpu", "12", 12, true},
+		{"wp_cpu", "high", 0, false},
+	}
+	for _, test := range tests {
+		number, err := vm.number(test.field, test.value)
+		if test.ok {
+			assert.NoError(err)
+			assert.Equal(test.number, number)
+		} else {
+			assert.Error(err)
+		}
+	}
+
+	_, ok = checkValueMap(valueMap{"wp_table": {"dbvl": 1}}, []string{"wp_status"})
+	assert.False(ok)
+}
+
+func Test_ValueMapData(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t,
+		tomlMetric{
+			Name:           "sap_process_status",
+			Help:           "status per process",
+			MetricType:     "gauge",
+			FunctionModule: "TH_WPINFO",
+			TagFilter:      []string{"test"},
+			TableData: TableInfo{
+				Table:       "WPLIST",
+				RowLabels:   []string{"wp_typ", "wp_cpu"},
+				ValueColumn: "wp_status",
+				ValueMap: valueMap{
+					"wp_status": {"running": 1, "waiting": 0, "on hold": 2},
+				},
+			},
+		},
+		tomlMetric{
+			Name:           "sap_monitor_host",
+			Help:           "host state",
+			MetricType:     "gauge",
+			FunctionModule: "Z_MONITOR_INFO",
+			TagFilter:      []string{"test"},
+			FieldData: FieldInfo{
+				FieldValues: []string{"es_info.host"},
+				ValueMap: valueMap{
+					"ES_INFO.HOST": {"host2": 1, "default": -1},
+				},
+			},
+		},
+		tomlMetric{
+			Name:           "sap_monitor_sid",
+			Help:           "sid state",
+			MetricType:     "gauge",
+			FunctionModule: "Z_MONITOR_INFO",
+			TagFilter:      []string{"test"},
+			StructureData: StructureInfo{
+				ExportStructure: "es_info",
+				StructureFields: []string{"sid"},
+				ValueMap: valueMap{
+					"sid": {"t01": 1},
+				},
+			},
+		},
+	)
+	config.Systems[0].Tags = []string{"test"}
+
+	for _, md := range config.collectMetrics() {
+		switch md.name {
+		case "sap_process_status":
+			assert.Equal(6, len(md.stats))
+			r, _ := findRecord(md.stats, "t01", "bgd", "5")
+			assert.Equal(2.0, r.value)
+			r, _ = findRecord(md.stats, "t01", "dia", "1")
+			assert.Equal(0.0, r.value)
+			r, _ = findRecord(md.stats, "t01", "dia", "20")
+			assert.Equal(1.0, r.value)
+		case "sap_monitor_host":
+			assert.Equal(1, len(md.stats))
+			assert.Equal(-1.0, md.stats[0].value)
+		case "sap_monitor_sid":
+			assert.Equal(1, len(md.stats))
+			assert.Equal(1.0, md.stats[0].value)
+		default:
+			t.Error("unexpected metric " + md.name)
+		}
+	}
+}
+
+func Test_ValueConv(t *testing.T) {
+	assert := assert.New(t)
+
+	vc, ok := newValueConv(
+		valueMap{"wp_status": {"running": 1}},
+		map[string]float64{"WP_PAGES": 8},
+		map[string]string{"wp_pages": "KB", "wp_cpu": "cs", "wp_status": "s"},
+		[]string{"wp_status", "wp_pages", "wp_cpu", "wp_eltime"},
+	)
+	assert.True(ok)
+
+	number, err := vc.number("wp_pages", 2)
+	assert.NoError(err)
+	assert.Equal(16384.0, number)
+	number, err = vc.number("WP_CPU", "250")
+	assert.NoError(err)
+	assert.Equal(2.5, number)
+	number, err = vc.number("wp_eltime", 7)
+	assert.NoError(err)
+	assert.Equal(7.0, number)
+
+	// mapped values are not scaled
+	number, err = vc.number("wp_status", "Running")
+	assert.NoError(err)
+	assert.Equal(1.0, number)
+
+	_, ok = newValueConv(nil, nil, map[string]string{"wp_cpu": "fortnights"}, []string{"wp_cpu"})
+	assert.False(ok)
+	_, ok = newValueConv(nil, nil, map[string]string{"wp_typ": "s"}, []string{"wp_cpu"})
+	assert.False(ok)
+	_, ok = newValueConv(nil, map[string]float64{"wp_cpu": 0}, nil, []string{"wp_cpu"})
+	assert.False(ok)
+}
+
+func Test_CheckUnit(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		name       string
+		metricType string
+		unit       string
+		fieldUnits map[string]string
+		ok         bool
+	}{
+		{"sap_memory_used_bytes", "gauge", "", map[string]string{"used": "kb"}, true},
+		{"sap_memory_used_bytes", "gauge", "bytes", map[string]string{"used": "kb", "total": "mb"}, true},
+		{"sap_cpu_seconds_total", "counter", "", map[string]string{"cpu": "ms"}, true},
+		{"sap_cpu_seconds_total", "gauge", "", map[string]string{"cpu": "ms"}, false},
+		{"sap_memory_used", "gauge", "", map[string]string{"used": "kb"}, false},
+		{"sap_memory_used_seconds", "gauge", "seconds", map[string]string{"used": "kb"}, false},
+		{"sap_memory_used_bytes", "gauge", "", map[string]string{"used": "kb", "time": "ms"}, false},
+		{"sap_temperature_celsius", "gauge", "celsius", nil, true},
+		{"sap_temperature", "gauge", "celsius", nil, false},
+		{"sap_processes", "gauge", "", nil, true},
+	}
+	for _, test := range tests {
+		err := checkUnit(test.name, test.metricType, test.unit, test.fieldUnits)
+		assert.Equal(test.ok, err == nil, test.name)
+	}
+}
+
+func Test_UnitData(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t,
+		tomlMetric{
+			Name:           "sap_monitor_memory_bytes",
+			Help:           "memory",
+			MetricType:     "gauge",
+			FunctionModule: "Z_MONITOR_INFO",
+			TagFilter:      []string{"test"},
+			FieldData: FieldInfo{
+				FieldValues: []string{"es_info.memory.used"},
+				Units:       map[string]string{"es_info.memory.used": "kb", "es_info.memory.total": "kb"},
+				Derived: map[string]string{
+					"free": "es_info.memory.total - es_info.memory.used",
+				},
+			},
+		},
+		tomlMetric{
+			Name:           "sap_process_cpu_seconds",
+			Help:           "cpu time per process",
+			MetricType:     "gauge",
+			Unit:           "seconds",
+			FunctionModule: "TH_WPINFO",
+			TagFilter:      []string{"test"},
+			TableData: TableInfo{
+				Table:       "WPLIST",
+				Aggregate:   "sum",
+				ValueColumn: "wp_cpu",
+				Units:       map[string]string{"wp_cpu": "ms"},
+			},
+		},
+	)
+	config.Systems[0].Tags = []string{"test"}
+
+	for _, md := range config.collectMetrics() {
+		switch md.name {
+		case "sap_monitor_memory_bytes":
+			r, _ := findRecord(md.stats, "t01", "es_info.memory.used")
+			assert.Equal(3072.0*1024, r.value)
+			// the fields of derived values are scaled before the computation
+			r, _ = findRecord(md.stats, "t01", "free")
+			assert.Equal(1024.0*1024, r.value)
+		case "sap_process_cpu_seconds":
+			assert.Equal(1, len(md.stats))
+			assert.InDelta(0.338, md.stats[0].value, 1e-9)
+		default:
+			t.Error("unexpected metric " + md.name)
+		}
+	}
+
+	_, err := checkTomlMetric(tomlMetric{
+		Name:           "sap_monitor_memory",
+		Help:           "memory",
+		MetricType:     "gauge",
+		FunctionModule: "Z_MONITOR_INFO",
+		FieldData: FieldInfo{
+			FieldValues: []string{"es_info.memory.used"},
+			Units:       map[string]string{"es_info.memory.used": "kb"},
+		},
+	})
+	assert.Error(err)
+}
+
+func Test_SapTimes(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		parse  func(interface{}) (float64, error)
+		value  interface{}
+		number float64
+	}{
+		{sapDate, "20201231", 1609372800},
+		{sapDate, "2020-12-31", 1609372800},
+		{sapDate, time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC), 1609372800},
+		{sapTime, "235959", 86399},
+		{sapTime, "01:00:30", 3630},
+		{sapTime, time.Date(0, 1, 1, 1, 0, 30, 0, time.UTC), 3630},
+		{sapTimestamp, "20201231235959", 1609459199},
+		{sapTimestamp, int64(20201231235959), 1609459199},
+		{sapTimestamp, 20210101000000.5, 1609459200.5},
+		{sapTimestamp, "2021-01-01T01:00:00+01:00", 1609459200},
+	}
+	for _, test := range tests {
+		number, err := test.parse(test.value)
+		assert.NoError(err, test.value)
+		assert.Equal(test.number, number, test.value)
+	}
+
+	for _, value := range []interface{}{"00000000", "", "2020123", 42, nil} {
+		_, err := sapDate(value)
+		assert.Error(err, value)
+	}
+
+	// times of gorfc without units
+	number, err := i2Float64(time.Date(2020, 12, 31, 23, 59, 59, 0, time.UTC))
+	assert.NoError(err)
+	assert.Equal(1609459199.0, number)
+	number, err = i2Float64(time.Date(0, 1, 1, 23, 59, 59, 0, time.UTC))
+	assert.NoError(err)
+	assert.Equal(86399.0, number)
+}
+
+func Test_SapTimeData(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t, tomlMetric{
+		Name:           "sap_monitor_timestamp_seconds",
+		Help:           "times",
+		MetricType:     "gauge",
+		FunctionModule: "Z_MONITOR_INFO",
+		TagFilter:      []string{"test"},
+		FieldData: FieldInfo{
+			FieldValues: []string{"ev_cert_expiry", "ev_stat_timestamp", "ev_no_date"},
+			Units: map[string]string{
+				"ev_backup_date":    "date",
+				"ev_backup_time":    "time",
+				"ev_cert_expiry":    "timestamp",
+				"ev_stat_timestamp": "timestamp",
+				"ev_no_date":        "date",
+			},
+			Derived: map[string]string{
+				"last_backup": "ev_backup_date + ev_backup_time",
+			},
+		},
+	})
+	config.Systems[0].Tags = []string{"test"}
+
+	data := config.collectMetrics()
+	assert.Equal(1, len(data))
+
+	// the initial date 00000000 is skipped
+	assert.Equal(3, len(data[0].stats))
+	r, _ := findRecord(data[0].stats, "t01", "ev_cert_expiry")
+	assert.Equal(1640952000.0, r.value)
+	r, _ = findRecord(data[0].stats, "t01", "ev_stat_timestamp")
+	assert.Equal(1609459200.5, r.value)
+	r, _ = findRecord(data[0].stats, "t01", "last_backup")
+	assert.Equal(1609459199.0, r.value)
+}
+
+func Test_FormatValue(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		value interface{}
+		text  string
+	}{
+		{"DIA", "DIA"},
+		{42, "42"},
+		{int64(-7), "-7"},
+		{1.5, "1.5"},
+		{float32(0.25), "0.25"},
+		{20210101000000.5, "20210101000000.5"},
+		{time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC), "2020-12-31"},
+		{time.Date(0, 1, 1, 23, 59, 59, 0, time.UTC), "23:59:59"},
+		{time.Date(2020, 12, 31, 23, 59, 59, 0, time.UTC), "2020-12-31T23:59:59"},
+		{nil, ""},
+	}
+	for _, test := range tests {
+		assert.Equal(test.text, formatValue(test.value), test.value)
+	}
+}
@@ -52,6 +52,19 @@ type metricRecord struct {
 	value       float64
 	labels      []string
 	labelValues []string
+
+	// histogram and summary data
+	count     uint64
+	sum       float64
+	buckets   map[float64]uint64
+	quantiles map[float64]float64
+}
+
+// metric records of one system, answered is false if no server delivered data
+type systemRecords struct {
+	system   string
+	records  []metricRecord
+	answered bool
 }
 
 // webCmd represents the web command
@@ -84,6 +97,33 @@ var webCmd = &cobra.Command{
 		if err != nil {
 			exit("Problem with port flag: ", err)
 		}
+		config.maxOpen, err = cmd.Flags().GetUint("max-open")
+		if err != nil {
+			exit("Problem with max-open flag: ", err)
+		}
+		config.maxIdle, err = cmd.Flags().GetUint("max-idle")
+		if err != nil {
+			exit("Problem with max-idle flag: ", err)
+		}
+		config.lifetime, err = cmd.Flags().GetUint("max-lifetime")
+		if err != nil {
+			exit("Problem with max-lifetime flag: ", err)
+		}
+		config.discovery, err = cmd.Flags().GetUint("discovery-interval")
+		if err != nil {
+			exit("Problem with discovery-interval flag: ", err)
+		}
+		config.background, err = cmd.Flags().GetBool("background")
+		if err != nil {
+			exit("Problem with background flag: ", err)
+		}
+		config.interval, err = cmd.Flags().GetUint("interval")
+		if err != nil {
+			exit("Problem with interval flag: ", err)
+		}
+		if config.background && 0 == config.interval {
+			exit("Problem with interval flag: ", errors.New("the interval must be greater than 0 in background mode"))
+		}
 
 		// set data func
 		// config.DataFunc = config.GetMetricData
@@ -100,6 +140,12 @@ func init() {
 
 	webCmd.PersistentFlags().UintP("timeout", "t", 5, "scrape timeout of the hana_sql_exporter in seconds.")
 	webCmd.PersistentFlags().StringP("port", "p", "9663", "port, the hana_sql_exporter listens to.")
+	webCmd.PersistentFlags().Uint("max-open", 2, "max number of open rfc connections per application server (0 = unlimited).")
+	webCmd.PersistentFlags().Uint("max-idle", 2, "max number of idle rfc connections per application server, at least max-open.")
+	webCmd.PersistentFlags().Uint("max-lifetime", 3600, "max lifetime of a rfc connection in seconds (0 = unlimited).")
+	webCmd.PersistentFlags().Uint("discovery-interval", 300, "interval of the application server discovery in seconds.")
+	webCmd.PersistentFlags().Bool("background", false, "collect the metrics in the background and serve the last results.")
+	webCmd.PersistentFlags().Uint("interval", 60, "collection interval of the metrics in background mode in seconds.")
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
@@ -119,8 +165,10 @@ func newCollector(stats func() []metricData) *collector {
 }
 
 // Describe implements prometheus.Collector.
+// The metrics are only known after a collection, so no descriptions are sent
+// and the collector is unchecked. Otherwise every registration - also the
+// per request registration of /probe - would call the sap systems.
 func (c *collector) Describe(ch chan<- *prometheus.Desc) {
-	prometheus.DescribeByCollect(c, ch)
 }
 
 // Collect - implements prometheus.Collector.
@@ -131,15 +179,21 @@ func (c *collector) Collect(ch chan<- prometheus.Metric) {
 	var valueType = map[string]prometheus.ValueType{
 		"gauge":   prometheus.GaugeValue,
 		"counter": prometheus.CounterValue,
+		"info":    prometheus.GaugeValue,
 	}
 	for _, mi := range stats {
 		for _, v := range mi.stats {
-			m := prometheus.MustNewConstMetric(
-				prometheus.NewDesc(mi.name, mi.help, v.labels, nil),
-				valueType[mi.metricType],
-				v.value,
-				v.labelValues...,
-			)
+			desc := prometheus.NewDesc(mi.name, mi.help, v.labels, nil)
+
+			var m prometheus.Metric
+			switch mi.metricType {
+			case "histogram":
+				m = prometheus.MustNewConstHistogram(desc, v.count, v.sum, v.buckets, v.labelValues...)
+			case "summary":
+				m = prometheus.MustNewConstSummary(desc, v.count, v.sum, v.quantiles, v.labelValues...)
+			default:
+				m = prometheus.MustNewConstMetric(desc, valueType[mi.metricType], v.value, v.labelValues...)
+			}
 			ch <- m
 		}
 	}
@@ -167,24 +221,43 @@ func (config *Config) web() error {
 	// 	exit(fmt.Sprint(" timeout flag has wrong type", err))
 	// }
 
-	stats := func() []metricData {
-		data := config.collectMetrics()
-		return data
+	// long-lived rfc connections shared by all metrics
+	config.pool = newConnPool(config.connect, int(config.maxOpen), int(config.maxIdle), time.Duration(config.lifetime)*time.Second)
+	defer config.pool.close()
+
+	// application server discovery in the background
+	stop := make(chan struct{})
+	defer close(stop)
+	config.servers = newSrvCache()
+	config.startDiscovery(stop)
+	prometheus.MustRegister(config.servers)
+
+	// exporter self-monitoring
+	registerHealthMetrics(prometheus.DefaultRegisterer)
+
+	// last results of metrics collected in the background or with an own interval
+	config.snapshots = newSnapshotStore()
+	prometheus.MustRegister(config.snapshots)
+
+	// collect metrics in the background and serve the last results
+	if config.background {
+		config.startScheduler(stop)
 	}
 
-	c := newCollector(stats)
+	c := newCollector(config.metricStats(config.IntMetrics))
 	prometheus.MustRegister(c)
 
 	// start http server
 	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/metrics", config.metricsHandler(promhttp.Handler()))
+	mux.HandleFunc("/probe", config.probeHandler)
 	mux.HandleFunc("/", rootHandler)
 
 	server := &http.Server{
 		Addr:         ":" + config.port,
 		Handler:      mux,
-		WriteTimeout: time.Duration(config.Timeout+2) * time.Second,
-		ReadTimeout:  time.Duration(config.Timeout+2) * time.Second,
+		WriteTimeout: config.maxTimeout() + 2*time.Second,
+		ReadTimeout:  config.maxTimeout() + 2*time.Second,
 	}
 	err = server.ListenAndServe()
 	if err != nil {
@@ -195,7 +268,20 @@ func (config *Config) web() error {
 }
 
 func rootHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "prometheus sapnwrfc_exporter: please call <host>:<port>/metrics")
+	fmt.Fprintf(w, "prometheus sapnwrfc_exporter: please call <host>:<port>/metrics or <host>:<port>/probe?system=<system>")
+}
+
+// stats func of the collector for the given metrics
+func (config *Config) metricStats(metrics []metricInfo) func() []metricData {
+	if config.background {
+		return func() []metricData {
+			return config.snapshots.metricData(metrics)
+		}
+	}
+
+	sel := *config
+	sel.IntMetrics = metrics
+	return sel.collectMetrics
 }
 
 // start collecting all metrics and fetch the results
@@ -210,11 +296,32 @@ func (config *Config) collectMetrics() []metricData {
 		wg.Add(1)
 		go func(mPos int) {
 			defer wg.Done()
+
+			// metrics with an own interval are collected only if the
+			// last collection is older than the interval, concurrent
+			// scrapes wait for the running collection
+			if config.IntMetrics[mPos].Interval > 0 && config.snapshots != nil {
+				unlock := config.snapshots.lockMetric(config.IntMetrics[mPos].Name)
+				defer unlock()
+
+				md, ok := config.snapshots.recent(config.IntMetrics[mPos].Name, config.metricInterval(mPos))
+				if !ok {
+					config.snapshots.store(config.IntMetrics[mPos], config.collectSystemsMetric(mPos), config.snapshotMaxAge(mPos))
+					md = config.snapshots.metricData(config.IntMetrics[mPos : mPos+1])[0]
+				}
+				mDataC <- md
+				return
+			}
+
+			var stats []metricRecord
+			for _, records := range config.collectSystemsMetric(mPos) {
+				stats = append(stats, records...)
+			}
 			mDataC <- metricData{
 				name:       config.IntMetrics[mPos].Name,
 				help:       config.IntMetrics[mPos].Help,
 				metricType: config.IntMetrics[mPos].MetricType,
-				stats:      config.collectSystemsMetric(mPos),
+				stats:      stats,
 			}
 		}(mPos)
 	}
@@ -233,13 +340,14 @@ func (config *Config) collectMetrics() []metricData {
 }
 
 // start collecting metric information for all tenants
-func (config *Config) collectSystemsMetric(mPos int) []metricRecord {
+// the result contains the records of every system that answered, possibly empty
+func (config *Config) collectSystemsMetric(mPos int) map[string][]metricRecord {
 
-	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Duration(config.Timeout)*time.Second))
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(config.metricTimeout(mPos)))
 	defer cancel()
 
 	sysCnt := len(config.Systems)
-	mRecordsC := make(chan []metricRecord, sysCnt)
+	mRecordsC := make(chan systemRecords, sysCnt)
 
 	for sPos := range config.Systems {
 		go func(sPos int) {
@@ -247,53 +355,79 @@ func (config *Config) collectSystemsMetric(mPos int) []metricRecord {
 			// all values of Metrics.TagFilter must be in Tenants.Tags, otherwise the
 			// metric is not relevant for the tenant
 			if !subSliceInSlice(config.IntMetrics[mPos].TagFilter, config.Systems[sPos].Tags) {
-				mRecordsC <- nil
+				mRecordsC <- systemRecords{system: config.Systems[sPos].Name}
 				return
 			}
 
-			servers := config.getSrvInfo(mPos, sPos)
+			servers := config.getSrvInfo(ctx, mPos, sPos)
 			if servers == nil {
-				mRecordsC <- nil
+				mRecordsC <- systemRecords{system: config.Systems[sPos].Name}
 				return
 			}
-
-			for _, srv := range servers {
-				defer srv.conn.Close()
-			}
-			mRecordsC <- config.collectServersMetric(mPos, sPos, servers)
+			records, answered := config.collectServersMetric(ctx, mPos, sPos, servers)
+			mRecordsC <- systemRecords{config.Systems[sPos].Name, records, answered}
 		}(sPos)
 	}
 
-	var sData []metricRecord
+	sData := make(map[string][]metricRecord)
+	answered := make(map[string]bool)
 	for i := 0; i < sysCnt; i++ {
 		select {
 		case mc := <-mRecordsC:
-
-			// fmt.Println("OKE", mc)
-			if mc != nil {
-				sData = append(sData, mc...)
+			// results after the deadline belong to timed out systems
+			if ctx.Err() != nil {
+				config.recordTimeouts(mPos, answered)
+				return sData
+			}
+			answered[mc.system] = true
+			if mc.answered {
+				sData[mc.system] = mc.records
 			}
 		case <-ctx.Done():
-
-			// fmt.Println("TIMEOUT!")
+			config.recordTimeouts(mPos, answered)
 			return sData
 		}
 	}
+	config.recordTimeouts(mPos, answered)
 	return sData
 }
 
+// record the systems, that did not answer within the metric timeout
+// their late results are discarded and their connections closed
+func (config *Config) recordTimeouts(mPos int, answered map[string]bool) {
+	for _, system := range config.Systems {
+		if answered[system.Name] {
+			scrapeTimedOut.WithLabelValues(system.Name, config.IntMetrics[mPos].Name).Set(0)
+			continue
+		}
+		log.WithFields(log.Fields{
+			"system": system.Name,
+			"metric": config.IntMetrics[mPos].Name,
+		}).Warn("Timeout while collecting metric")
+		scrapeTimeouts.WithLabelValues(system.Name, config.IntMetrics[mPos].Name).Inc()
+		scrapeTimedOut.WithLabelValues(system.Name, config.IntMetrics[mPos].Name).Set(1)
+	}
+}
+
 // get metric data for the system application servers
-func (config *Config) collectServersMetric(mPos, sPos int, servers []serverInfo) []metricRecord {
+// false if the function module call failed on all servers
+func (config *Config) collectServersMetric(ctx context.Context, mPos, sPos int, servers []serverInfo) ([]metricRecord, bool) {
+
+	type srvRecords struct {
+		records  []metricRecord
+		answered bool
+	}
 
 	var wg sync.WaitGroup
-	mRecordsC := make(chan []metricRecord, len(servers))
+	mRecordsC := make(chan srvRecords, len(servers))
 
 	for _, srv := range servers {
 
 		wg.Add(1)
 		go func(srv serverInfo) {
 			defer wg.Done()
-			mRecordsC <- config.getRfcData(mPos, sPos, srv)
+			records, answered := config.getRfcData(ctx, mPos, sPos, srv)
+			mRecordsC <- srvRecords{records, answered}
 		}(srv)
 	}
 
@@ -302,47 +436,43 @@ func (config *Config) collectServersMetric(mPos, sPos int, servers []serverInfo)
 		close(mRecordsC)
 	}()
 
-	var srvData []metricRecord
+	srvData := []metricRecord{}
+	answered := false
 	for metric := range mRecordsC {
-		srvData = append(srvData, metric...)
+		srvData = append(srvData, metric.records...)
+		answered = answered || metric.answered
 	}
 
-	return srvData
+	return srvData, answered
 }
 
 // get data from sap system
-func (config *Config) getRfcData(mPos, sPos int, srv serverInfo) []metricRecord {
+// false if the function module call failed
+func (config *Config) getRfcData(ctx context.Context, mPos, sPos int, srv serverInfo) ([]metricRecord, bool) {
 
 	// !!!!!!!!!!!!!!!
 	// t := rand.Intn(5)
 	// time.Sleep(time.Duration(t) * time.Second)
 
-	// check if all configfile param keys are uppercase otherwise the function call returns an error
-	for k, v := range config.IntMetrics[mPos].Params {
-		upKey := up(k)
-		if !(upKey == k) {
-			config.IntMetrics[mPos].Params[upKey] = v
-			delete(config.IntMetrics[mPos].Params, k)
-		}
-	}
 	// call function module
-	rawData, err := srv.conn.Call(up(config.IntMetrics[mPos].FunctionModule), config.IntMetrics[mPos].Params)
+	rawData, err := config.pool.call(ctx, srv.system, config.passwords[config.Systems[sPos].Name], up(config.IntMetrics[mPos].FunctionModule), config.IntMetrics[mPos].Params)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"system": config.Systems[sPos].Name,
 			"server": srv.name,
 			"error":  err,
 		}).Error("Can't call function module")
-		return nil
+		return nil, false
 	}
 
-	return config.IntMetrics[mPos].special.metricData(rawData, config.Systems[sPos], srv.name)
+	return config.addLabels(config.IntMetrics[mPos].special.metricData(rawData, config.Systems[sPos], srv.name), mPos, sPos), true
 }
 
 // retrieve table data
 func (tMetric TableInfo) metricData(rawData map[string]interface{}, system SystemInfo, srvName string) []metricRecord {
 
-	if rawData[up(tMetric.Table)] == nil {
+	lines, ok := tableRows(rawData, tMetric.Table)
+	if !ok {
 		log.WithFields(log.Fields{
 			"system": system.Name,
 			"server": srvName,
@@ -351,32 +481,49 @@ func (tMetric TableInfo) metricData(rawData map[string]interface{}, system Syste
 		return nil
 	}
 
+	var rows []map[string]interface{}
+	for _, line := range lines {
+		if tMetric.rowOK(line) {
+			rows = append(rows, line)
+		}
+	}
+
+	if len(tMetric.Aggregate) > 0 {
+		return tMetric.aggregateData(rows, system, srvName)
+	}
+	if len(tMetric.RowLabels) > 0 {
+		return tMetric.rowData(rows, system, srvName)
+	}
+	if len(tMetric.Buckets) > 0 || len(tMetric.Quantiles) > 0 {
+		return tMetric.distributionData(rows, system, srvName)
+	}
+
 	var md []metricRecord
 	count := make(map[string]float64)
 
-	for _, res := range rawData[up(tMetric.Table)].([]interface{}) {
-		line := res.(map[string]interface{})
-
-		if len(tMetric.RowFilter) == 0 || inFilter(line, tMetric.RowFilter) {
-			for field, values := range tMetric.RowCount {
-				for _, value := range values {
-					namePart := low(interface2String(value))
-					if "" == namePart {
-						log.WithFields(log.Fields{
-							"value":  namePart,
-							"system": system.Name,
-						}).Error("Configfile RowCount: only string and int types are allowed")
-						continue
-					}
-
-					if strings.HasPrefix(low(interface2String(line[up(field)])), namePart) || "total" == namePart {
-						count[low(field)+"_"+namePart]++
-					}
+	for _, line := range rows {
+		for field, values := range tMetric.RowCount {
+			for _, value := range values {
+				namePart := low(interface2String(value))
+				if "" == namePart {
+					log.WithFields(log.Fields{
+						"value":  namePart,
+						"system": system.Name,
+					}).Error("Configfile RowCount: only string and int types are allowed")
+					continue
+				}
+
+				if "total" == namePart || tMetric.rowCountMatch(field, namePart, low(interface2String(line[up(field)]))) {
+					count[low(field)+"_"+namePart]++
 				}
 			}
 		}
 	}
 
+	if tMetric.FieldAsLabel {
+		return tMetric.fieldLabelData(count, system, srvName)
+	}
+
 	for field, values := range tMetric.RowCount {
 		for _, value := range values {
 			namePart := low(interface2String(value))
@@ -411,6 +558,7 @@ func (fMetric FieldInfo) metricData(rawData map[string]interface{}, system Syste
 		md = fMetric.getFieldLabels(rawData, labels, labelValues)
 	} else {
 		md = fMetric.getFieldValues(rawData, labels, labelValues)
+		md = append(md, fMetric.derived.metricData(rawData, fMetric.conv, system, srvName, "")...)
 	}
 	return md
 
@@ -419,12 +567,17 @@ func (fMetric FieldInfo) metricData(rawData map[string]interface{}, system Syste
 // field label metrics
 func (fMetric FieldInfo) getFieldLabels(rawData map[string]interface{}, labels, labelValues []string) []metricRecord {
 
-	labels = append(labels, fMetric.FieldLabels...)
+	labels = append(labels, labelNames(fMetric.FieldLabels)...)
 	for _, label := range fMetric.FieldLabels {
-		if !fieldOK(rawData, label) {
+		values := fieldValues(rawData, label)
+		if 0 == len(values) {
 			return nil
 		}
-		labelValues = append(labelValues, low(rawData[up(label)].(string)))
+		labelValue := strings.TrimSpace(interface2String(values[0].value))
+		if !fMetric.KeepCase {
+			labelValue = low(labelValue)
+		}
+		labelValues = append(labelValues, labelValue)
 	}
 
 	if len(labels) != len(labelValues) {
@@ -449,27 +602,30 @@ func (fMetric FieldInfo) getFieldValues(rawData map[string]interface{}, labels,
 
 	labels = append(labels, "field")
 	for _, field := range fMetric.FieldValues {
-		if !fieldOK(rawData, field) {
+		values := fieldValues(rawData, field)
+		if 0 == len(values) {
 			return nil
 		}
 
-		f64Val, err := i2Float64(rawData[up(field)])
-		if err != nil {
-			log.WithFields(log.Fields{
-				"field":       field,
-				"field value": f64Val,
-			}).Error("metricData: field value is not a correct metric value")
+		for _, pv := range values {
+			f64Val, err := fMetric.conv.number(field, pv.value)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"field":       pv.path,
+					"field value": f64Val,
+				}).Error("metricData: field value is not a correct metric value")
 
-			continue
-		}
+				continue
+			}
 
-		labelValues := append(labelValuesBase, low(field))
-		data := metricRecord{
-			labels:      labels,
-			labelValues: labelValues,
-			value:       f64Val,
+			labelValues := append(labelValuesBase, pv.path)
+			data := metricRecord{
+				labels:      labels,
+				labelValues: labelValues,
+				value:       f64Val,
+			}
+			md = append(md, data)
 		}
-		md = append(md, data)
 	}
 	return md
 }
@@ -478,7 +634,8 @@ func (fMetric FieldInfo) getFieldValues(rawData map[string]interface{}, labels,
 // only numbers are allowed
 func (sMetric StructureInfo) metricData(rawData map[string]interface{}, system SystemInfo, srvName string) []metricRecord {
 
-	if _, ok := rawData[up(sMetric.ExportStructure)]; !ok {
+	structures := resolvePath(rawData, sMetric.ExportStructure)
+	if 0 == len(structures) {
 		log.WithFields(log.Fields{
 			"system":          system.Name,
 			"server":          srvName,
@@ -488,123 +645,61 @@ func (sMetric StructureInfo) metricData(rawData map[string]interface{}, system S
 	}
 
 	var md []metricRecord
-	for _, field := range sMetric.StructureFields {
-		val := rawData[up(sMetric.ExportStructure)].(map[string]interface{})[up(field)]
-		if val == nil {
-			log.WithFields(log.Fields{
-				"system":         system.Name,
-				"server":         srvName,
-				"structureField": field,
-			}).Error("metricData: structureField is no valid export strucure field of used function module")
-			return nil
-		}
-
-		f64Val, err := i2Float64(val)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"system":         system.Name,
-				"server":         srvName,
-				"structureField": field,
-			}).Error("metricData: structureField is not a correct metric value")
-
+	for _, structure := range structures {
+		fields, ok := structure.value.(map[string]interface{})
+		if !ok {
 			continue
 		}
 
-		labels := append([]string{"system", "usage", "server", "field"})
-		labelValues := append([]string{system.Name, system.Usage, srvName, low(field)})
-
-		data := metricRecord{
-			labels:      labels,
-			labelValues: labelValues,
-			value:       f64Val,
-		}
-		md = append(md, data)
-	}
-
-	return md
-}
-
-// retrieve system servers
-func (config *Config) getSrvInfo(mPos, sPos int) []serverInfo {
-
-	c, err := connect(config.Systems[sPos], config.passwords[config.Systems[sPos].Name])
-	if err != nil {
-		log.WithFields(log.Fields{
-			"system": config.Systems[sPos].Name,
-			"error":  err,
-		}).Error("No connection to sap system possible")
-		return nil
-	}
-
-	params := map[string]interface{}{}
-	r, err := c.Call("TH_SERVER_LIST", params)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"system": config.Systems[sPos].Name,
-			"error":  err,
-		}).Error("Can't call fumo th_server_list")
-		return nil
-	}
-
-	// Issue 5 why is r["LIST"] == nil ?????
-	if r["LIST"] == nil {
-		return []serverInfo{{config.Systems[sPos].Name, c}}
-	}
-	srvCnt := len(r["LIST"].([]interface{}))
-
-	// if only one server is needed for the metric
-	// or if all servers are needed but only one server exists
-	// -> return the standard connection. it will be closed in getRfcData.
-	if !config.Metrics[mPos].AllServers || 1 == srvCnt {
-		return []serverInfo{{config.Systems[sPos].Name, c}}
-	}
-
-	// if more servers exists, they get their own connection below
-	// -> the standard connection has to be closed now
-	c.Close()
+		for _, field := range sMetric.StructureFields {
+			values := resolvePath(fields, field)
+			if 0 == len(values) {
+				log.WithFields(log.Fields{
+					"system":         system.Name,
+					"server":         srvName,
+					"structureField": field,
+				}).Error("metricData: structureField is no valid export strucure field of used function module")
+				return nil
+			}
 
-	srvConnC := make(chan serverInfo, srvCnt)
-	var wg sync.WaitGroup
-	for _, v := range r["LIST"].([]interface{}) {
-		wg.Add(1)
+			for _, pv := range values {
+				f64Val, err := sMetric.conv.number(field, pv.value)
+				if err != nil {
+					log.WithFields(log.Fields{
+						"system":         system.Name,
+						"server":         srvName,
+						"structureField": pv.path,
+					}).Error("metricData: structureField is not a correct metric value")
 
-		go func(v interface{}) {
-			defer wg.Done()
+					continue
+				}
 
-			appl := v.(map[string]interface{})
-			if _, ok := appl["NAME"]; !ok {
-				return
-			}
-			info := strings.Split(strings.TrimSpace(appl["NAME"].(string)), "_")
+				// fields of several structures are distinguished by the structure path
+				fieldName := pv.path
+				if len(structures) > 1 {
+					fieldName = structure.path + "." + pv.path
+				}
 
-			sys := config.Systems[sPos]
-			sys.Server = strings.TrimSpace(info[0])
-			sys.Sysnr = strings.TrimSpace(info[2])
+				labels := []string{"system", "usage", "server", "field"}
+				labelValues := []string{system.Name, system.Usage, srvName, fieldName}
 
-			srv, err := connect(sys, config.passwords[config.Systems[sPos].Name])
-			if err != nil {
-				log.WithFields(log.Fields{
-					"server": info[0],
-					"error":  err,
-				}).Error("error from getServerConnections")
-			} else {
-				srvConnC <- serverInfo{info[0], srv}
+				data := metricRecord{
+					labels:      labels,
+					labelValues: labelValues,
+					value:       f64Val,
+				}
+				md = append(md, data)
 			}
-		}(v)
-	}
-
-	go func() {
-		wg.Wait()
-		close(srvConnC)
-	}()
+		}
 
-	var servers []serverInfo
-	for server := range srvConnC {
-		servers = append(servers, server)
+		prefix := ""
+		if len(structures) > 1 {
+			prefix = structure.path + "."
+		}
+		md = append(md, sMetric.derived.metricData(fields, sMetric.conv, system, srvName, prefix)...)
 	}
 
-	// return connections for all servers. they will be closed in getRfcData.
-	return servers
+	return md
 }
 
 // add passwords and system servers to config.Systems
@@ -670,18 +765,24 @@ func i2Float64(iVal interface{}) (float64, error) {
 		return float64(val), nil
 	case float64:
 		return float64(val), nil
+	case time.Time:
+		// sap times without date (TIMS) are seconds since midnight
+		if val.Year() == 0 {
+			return float64(val.Hour()*3600+val.Minute()*60+val.Second()) + float64(val.Nanosecond())/1e9, nil
+		}
+		return float64(val.Unix()) + float64(val.Nanosecond())/1e9, nil
 	default:
 	}
 	return 42.0, errors.New("i2Float64 - unknown type: ")
 }
 
-// check, if toml field value, field label is valid sap field
-func fieldOK(rawData map[string]interface{}, field string) bool {
-	if rawData[up(field)] == nil {
+// values of a toml field value or field label path, nil if the path is no valid sap field
+func fieldValues(rawData map[string]interface{}, field string) []pathValue {
+	values := resolvePath(rawData, field)
+	if 0 == len(values) {
 		log.WithFields(log.Fields{
 			"field": field,
 		}).Error("metricData: field is no valid export,structure parameter of used function module")
-		return false
 	}
-	return true
+	return values
 }
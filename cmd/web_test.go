@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// test config with systems t01 and t02 of the fixture backend
+func getFakeConfig(t *testing.T, metrics ...tomlMetric) (*Config, *fakeBackend) {
+	fb, err := loadFakeBackend("testdata/fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{
+		Systems: []SystemInfo{
+			{Name: "t01", Usage: "test", User: "u1", Lang: "en", Client: "100", Server: "host1", Sysnr: "01"},
+			{Name: "t02", Usage: "prod", User: "u2", Lang: "en", Client: "100", Server: "host2", Sysnr: "00", Tags: []string{"erp"}},
+		},
+		Metrics:   metrics,
+		passwords: map[string]string{"t01": "pw1", "t02": "pw2"},
+		connector: fb.connect,
+		pool:      newConnPool(fb.connect, 2, 2, 0),
+		servers:   newSrvCache(),
+		Timeout:   3,
+	}
+	if err := config.fillInternalMetrics(); err != nil {
+		t.Fatal(err)
+	}
+	return config, fb
+}
+
+// find metric record with the given label values
+func findRecord(records []metricRecord, labelValues ...string) (metricRecord, bool) {
+	for _, r := range records {
+		if subSliceInSlice(labelValues, r.labelValues) {
+			return r, true
+		}
+	}
+	return metricRecord{}, false
+}
+
+func Test_TableDataRowCount(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t, tomlMetric{
+		Name:           "sap_processes",
+		Help:           "sm50",
+		MetricType:     "gauge",
+		FunctionModule: "TH_WPINFO",
+		AllServers:     true,
+		TableData: TableInfo{
+			Table: "WPLIST",
+			RowCount: map[string][]interface{}{
+				"wp_typ":   {"dia", "bgd"},
+				"wp_table": {"dbvl"},
+			},
+			RowFilter: map[string][]interface{}{
+				"wp_status": {"running"},
+			},
+		},
+	})
+
+	data := config.collectMetrics()
+	assert.Equal(1, len(data))
+	assert.Equal("sap_processes", data[0].name)
+
+	r, ok := findRecord(data[0].stats, "t01", "wp_typ_dia")
+	assert.True(ok)
+	assert.Equal(2.0, r.value)
+	r, ok = findRecord(data[0].stats, "t01", "wp_typ_bgd")
+	assert.True(ok)
+	assert.Equal(1.0, r.value)
+	r, ok = findRecord(data[0].stats, "t01", "wp_table_dbvl")
+	assert.True(ok)
+	assert.Equal(1.0, r.value)
+
+	// one record per application server of t02
+	r, ok = findRecord(data[0].stats, "t02", "host2", "wp_typ_bgd")
+	assert.True(ok)
+	assert.Equal(1.0, r.value)
+	r, ok = findRecord(data[0].stats, "t02", "host3", "wp_typ_dia")
+	assert.True(ok)
+	assert.Equal(2.0, r.value)
+}
+
+func Test_TableDataTotal(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t, tomlMetric{
+		Name:           "sap_lock_entries",
+		Help:           "sm12",
+		MetricType:     "gauge",
+		FunctionModule: "ENQUE_READ",
+		TagFilter:      []string{"erp"},
+		TableData: TableInfo{
+			Table: "ENQ",
+			RowCount: map[string][]interface{}{
+				"gclient": {"total", "100", "000"},
+			},
+		},
+	})
+
+	// t01 has no ENQUE_READ fixture and t02 is filtered by tag
+	config.Systems[0].Tags = []string{"erp"}
+	config.Systems[1].Tags = nil
+
+	data := config.collectMetrics()
+	assert.Equal(1, len(data))
+	assert.Equal(3, len(data[0].stats))
+
+	r, _ := findRecord(data[0].stats, "t01", "gclient_total")
+	assert.Equal(3.0, r.value)
+	r, _ = findRecord(data[0].stats, "t01", "gclient_100")
+	assert.Equal(2.0, r.value)
+	r, _ = findRecord(data[0].stats, "t01", "gclient_000")
+	assert.Equal(1.0, r.value)
+}
+
+func Test_FieldData(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t,
+		tomlMetric{
+			Name:           "sap_stapi_version",
+			Help:           "st-a/pi",
+			MetricType:     "gauge",
+			FunctionModule: "ANST_OCS_GET_COMPONENT_STATE",
+			FieldData: FieldInfo{
+				FieldLabels: []string{"EV_COMP_REL", "ev_comp_spp_level"},
+			},
+		},
+		tomlMetric{
+			Name:           "sap_tune_storage_infos",
+			Help:           "storage",
+			MetricType:     "gauge",
+			FunctionModule: "SAPTUNE_GET_STORAGE_INFOS",
+			AllServers:     true,
+			FieldData: FieldInfo{
+				FieldValues: []string{"page_bufsz"},
+			},
+		},
+	)
+
+	for _, md := range config.collectMetrics() {
+		switch md.name {
+		case "sap_stapi_version":
+			assert.Equal(1, len(md.stats))
+			assert.Equal([]string{"system", "usage", "server", "ev_comp_rel", "ev_comp_spp_level"}, md.stats[0].labels)
+			assert.Equal([]string{"t01", "test", "t01", "01t_731", "0003"}, md.stats[0].labelValues)
+			assert.Equal(1.0, md.stats[0].value)
+		case "sap_tune_storage_infos":
+			assert.Equal(3, len(md.stats))
+			r, ok := findRecord(md.stats, "t01", "page_bufsz")
+			assert.True(ok)
+			assert.Equal(1024.0, r.value)
+			r, ok = findRecord(md.stats, "t02", "host3", "page_bufsz")
+			assert.True(ok)
+			assert.Equal(2048.0, r.value)
+		default:
+			t.Error("unexpected metric " + md.name)
+		}
+	}
+}
+
+func Test_StructureData(t *testing.T) {
+	assert := assert.New(t)
+
+	config, fb := getFakeConfig(t, tomlMetric{
+		Name:           "sap_tune_programs_info",
+		Help:           "programs",
+		MetricType:     "gauge",
+		FunctionModule: "SAPTUNE_BUFFERED_PROGRAMS_INFO",
+		StructureData: StructureInfo{
+			ExportStructure: "info",
+			StructureFields: []string{"coll_ratio", "prg_swap", "prg_gen"},
+		},
+	})
+
+	data := config.collectMetrics()
+	assert.Equal(1, len(data))
+	assert.Equal(3, len(data[0].stats))
+
+	r, _ := findRecord(data[0].stats, "t01", "coll_ratio")
+	assert.Equal(97.5, r.value)
+	r, _ = findRecord(data[0].stats, "t01", "prg_swap")
+	assert.Equal(12.0, r.value)
+	r, _ = findRecord(data[0].stats, "t01", "prg_gen")
+	assert.Equal(3.0, r.value)
+
+	// t02 has no fixture for the function module
+	_, ok := findRecord(data[0].stats, "t02")
+	assert.False(ok)
+	assert.Equal(2, fb.callCount("SAPTUNE_BUFFERED_PROGRAMS_INFO"))
+}
+
+func Test_InfoMetric(t *testing.T) {
+	assert := assert.New(t)
+
+	config, _ := getFakeConfig(t,
+		tomlMetric{
+			Name:           "sap_release",
+			Help:           "release info",
+			MetricType:     "info",
+			FunctionModule: "Z_MONITOR_INFO",
+			TagFilter:      []string{"test"},
+			FieldData: FieldInfo{
+				FieldLabels: []string{"ev_release", "es_info.sid"},
+				KeepCase:    true,
+			},
+		},
+		tomlMetric{
+			Name:           "sap_host_info",
+			Help:           "host info",
+			MetricType:     "INFO",
+			FunctionModule: "Z_MONITOR_INFO",
+			TagFilter:      []string{"test"},
+			FieldData: FieldInfo{
+				FieldLabels: []string{"es_info.sid", "es_info.host"},
+			},
+		},
+	)
+	config.Systems[0].Tags = []string{"test"}
+
+	expected := `
+# HELP sap_host_info host info
+# TYPE sap_host_info gauge
+sap_host_info{es_info_host="host1",es_info_sid="t01",server="t01",system="t01",usage="test"} 1
+# HELP sap_release_info release info
+# TYPE sap_release_info gauge
+sap_release_info{es_info_sid="T01",ev_release="S4HANA 2020",server="t01",system="t01",usage="test"} 1
+`
+	c := newCollector(config.collectMetrics)
+	assert.NoError(testutil.CollectAndCompare(c, strings.NewReader(expected)))
+
+	// info metrics need field labels
+	_, err := checkTomlMetric(tomlMetric{
+		Name:           "sap_storage_info",
+		Help:           "storage",
+		MetricType:     "info",
+		FunctionModule: "SAPTUNE_GET_STORAGE_INFOS",
+		FieldData:      FieldInfo{FieldValues: []string{"page_bufsz"}},
+	})
+	assert.Error(err)
+}